@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	ErrorMissingToken = "missing-auth-token"
+	ErrorInvalidToken = "invalid-auth-token"
+	ErrorExpiredToken = "expired-auth-token"
+)
+
+type ApiToken struct {
+	Token string
+	User  string
+	Role  string
+}
+
+// ApiTokenAuthorizer authorizes service to service calls through the x-auth-token header.
+// Several tokens can be active at the same time so that they can be rotated
+type ApiTokenAuthorizer struct {
+	tokens []apiTokenHash
+}
+
+type apiTokenHash struct {
+	hash [sha256.Size]byte
+	auth Authorization
+}
+
+func NewApiTokenAuthorizer(tokens ...ApiToken) *ApiTokenAuthorizer {
+	a := &ApiTokenAuthorizer{}
+	for _, t := range tokens {
+		if t.Token == "" {
+			continue
+		}
+		a.tokens = append(a.tokens, apiTokenHash{
+			hash: sha256.Sum256([]byte(t.Token)),
+			auth: Authorization{User: t.User, Role: t.Role},
+		})
+	}
+
+	return a
+}
+
+func (a *ApiTokenAuthorizer) Authorize(_ context.Context, req *http.Request) Authorization {
+	token := ExtractApiToken(req)
+	if token == "" {
+		return Authorization{Error: errors.New(ErrorMissingToken)}
+	}
+
+	//Hashing gives equal lengths, every key is compared to keep the timing constant
+	h := sha256.Sum256([]byte(token))
+	found := -1
+	for i, t := range a.tokens {
+		if subtle.ConstantTimeCompare(h[:], t.hash[:]) == 1 {
+			found = i
+		}
+	}
+
+	if found < 0 {
+		return Authorization{Error: errors.New(ErrorInvalidToken)}
+	}
+
+	return a.tokens[found].auth
+}
+
+// ChainAuthorizer tries each Authorizer in order and returns the first successful Authorization
+type ChainAuthorizer []Authorizer
+
+func NewChainAuthorizer(aa ...Authorizer) ChainAuthorizer {
+	return aa
+}
+
+func (c ChainAuthorizer) Authorize(ctx context.Context, req *http.Request) Authorization {
+	ret := Authorization{Error: errors.New(ErrorMissingToken)}
+	for _, a := range c {
+		auth := a.Authorize(ctx, req)
+		if auth.Error == nil {
+			return auth
+		}
+		//A rejected credential is more relevant than a missing one
+		if ret.Error.Error() == ErrorMissingToken {
+			ret = auth
+		}
+	}
+
+	return ret
+}
+
+func ExtractBearerToken(req *http.Request) string {
+	h := req.Header.Get("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+
+	return ""
+}
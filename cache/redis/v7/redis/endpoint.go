@@ -0,0 +1,92 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/4books-sparta/utils"
+	"github.com/4books-sparta/utils/cache"
+	"github.com/4books-sparta/utils/logging"
+
+	"github.com/go-kit/kit/endpoint"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// EndpointKeyFunc returns the cache key of a request, the request is not cached when it is empty
+type EndpointKeyFunc func(ctx context.Context, request interface{}) (string, error)
+
+// EndpointCache caches the JSON responses of go-kit endpoints.
+// The cached responses carry an ETag, so that Forwarder answers 304 to clients sending it back
+type EndpointCache struct {
+	client redis.UniversalClient
+	rep    logging.ErrorReporter
+	group  singleflight.Group
+}
+
+func NewEndpointCache(c redis.UniversalClient, rep logging.ErrorReporter) *EndpointCache {
+	return &EndpointCache{
+		client: c,
+		rep:    rep,
+	}
+}
+
+// CachedEndpoint serves the responses of e from the cache for ttl.
+// Concurrent misses of a key share a single call to e; errors are never cached.
+// The refresh and skip cache context flags bypass the lookup, a refreshed response is stored anyway
+func (ec *EndpointCache) CachedEndpoint(e endpoint.Endpoint, keyFn EndpointKeyFunc, ttl time.Duration) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		key, err := keyFn(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		if key == "" || ec.client == nil || cache.IsSkipCacheContext(ctx) {
+			return e(ctx, request)
+		}
+
+		if !cache.IsForceRefreshCacheContext(ctx) {
+			p, err := ec.client.Get(ctx, key).Bytes()
+			if err == nil {
+				return utils.NewCachedResponse(p), nil
+			}
+			if !errors.Is(err, redis.Nil) {
+				ec.report(ctx, err, "redis-get-error", key)
+			}
+		}
+
+		//The shared call must not fail because the first caller has gone away
+		ch := ec.group.DoChan(key, func() (interface{}, error) {
+			res, err := e(context.WithoutCancel(ctx), request)
+			if err != nil {
+				return nil, err
+			}
+
+			p, err := json.Marshal(res)
+			if err != nil {
+				return nil, err
+			}
+			if err := ec.client.Set(context.WithoutCancel(ctx), key, p, ttl).Err(); err != nil {
+				ec.report(ctx, err, "redis-store-error", key)
+			}
+
+			return utils.NewCachedResponse(p), nil
+		})
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case res := <-ch:
+			return res.Val, res.Err
+		}
+	}
+}
+
+func (ec *EndpointCache) report(ctx context.Context, err error, msg string, key string) {
+	if ec.rep == nil {
+		return
+	}
+	logging.ReportCtx(ctx, ec.rep, err, msg, "key", key)
+}
@@ -0,0 +1,107 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/4books-sparta/utils"
+	"github.com/4books-sparta/utils/cache"
+)
+
+func bookKey(context.Context, interface{}) (string, error) {
+	return "book:1", nil
+}
+
+func cachedBody(t *testing.T, res interface{}, err error) string {
+	assert.Nil(t, err)
+	cr, ok := res.(utils.CachedResponse)
+	assert.True(t, ok)
+	return string(cr.Body)
+}
+
+func TestCachedEndpointCoalescesMisses(t *testing.T) {
+	ec := NewEndpointCache(fakeRedis(t, map[string]string{}), nil)
+
+	var calls, keys int32
+	release := make(chan struct{})
+	e := ec.CachedEndpoint(func(context.Context, interface{}) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return map[string]string{"title": "Book"}, nil
+	}, func(ctx context.Context, req interface{}) (string, error) {
+		atomic.AddInt32(&keys, 1)
+		return bookKey(ctx, req)
+	}, time.Minute)
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 5)
+	for i := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := e(context.Background(), nil)
+			bodies[i] = cachedBody(t, res, err)
+		}()
+	}
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&keys) == 5 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	for _, b := range bodies {
+		assert.JSONEq(t, `{"title":"Book"}`, b)
+	}
+
+	res, err := e(context.Background(), nil)
+	assert.JSONEq(t, `{"title":"Book"}`, cachedBody(t, res, err))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "served from the cache")
+}
+
+func TestCachedEndpointFlags(t *testing.T) {
+	ec := NewEndpointCache(fakeRedis(t, map[string]string{"book:1": `"cached"`}), nil)
+
+	var calls int32
+	e := ec.CachedEndpoint(func(context.Context, interface{}) (interface{}, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}, bookKey, time.Minute)
+
+	res, err := e(context.Background(), nil)
+	assert.Equal(t, `"cached"`, cachedBody(t, res, err))
+
+	res, err = e(cache.GetContextWithSkipCache(context.Background(), true), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), res, "skipping calls the endpoint")
+	res, err = e(context.Background(), nil)
+	assert.Equal(t, `"cached"`, cachedBody(t, res, err), "skipping does not store")
+
+	res, err = e(cache.GetContextWithForceRefreshCache(context.Background(), true), nil)
+	assert.Equal(t, "2", cachedBody(t, res, err))
+	res, err = e(context.Background(), nil)
+	assert.Equal(t, "2", cachedBody(t, res, err), "refreshing stores the response")
+}
+
+func TestCachedEndpointDoesNotCacheErrors(t *testing.T) {
+	ec := NewEndpointCache(fakeRedis(t, map[string]string{}), nil)
+
+	var calls int32
+	e := ec.CachedEndpoint(func(context.Context, interface{}) (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return nil, errors.New("unavailable")
+		}
+		return "ok", nil
+	}, bookKey, time.Minute)
+
+	_, err := e(context.Background(), nil)
+	assert.EqualError(t, err, "unavailable")
+
+	res, err := e(context.Background(), nil)
+	assert.Equal(t, `"ok"`, cachedBody(t, res, err))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
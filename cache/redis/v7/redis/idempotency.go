@@ -0,0 +1,91 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/4books-sparta/utils"
+	"github.com/4books-sparta/utils/cache"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	idempotencyInFlight        = "in-flight"
+	idempotencyReserveAttempts = 3
+)
+
+var _ utils.IdempotencyStore = (*IdempotencyStore)(nil)
+
+// IdempotencyStore shares the idempotency keys across the replicas of a service
+type IdempotencyStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+func NewIdempotencyStore(c redis.UniversalClient, prefix string) *IdempotencyStore {
+	return &IdempotencyStore{
+		client: c,
+		prefix: prefix,
+	}
+}
+
+func (s *IdempotencyStore) Reserve(ctx context.Context, key string, lockTTL time.Duration) (bool, *utils.StoredResponse, error) {
+	if s.client == nil {
+		return false, nil, errors.New(cache.RedisNotAvailableError)
+	}
+
+	var p []byte
+	for attempt := 0; ; attempt++ {
+		ok, err := s.client.SetNX(ctx, s.prefix+key, idempotencyInFlight, lockTTL).Result()
+		if err != nil {
+			return false, nil, err
+		}
+		if ok {
+			return true, nil, nil
+		}
+
+		p, err = s.client.Get(ctx, s.prefix+key).Bytes()
+		if errors.Is(err, redis.Nil) && attempt < idempotencyReserveAttempts {
+			//Expired between SetNX and Get, the key is free again
+			continue
+		}
+		if errors.Is(err, redis.Nil) || string(p) == idempotencyInFlight {
+			return false, nil, nil
+		}
+		if err != nil {
+			return false, nil, err
+		}
+		break
+	}
+
+	res := utils.StoredResponse{}
+	if err := json.Unmarshal(p, &res); err != nil {
+		return false, nil, err
+	}
+
+	return false, &res, nil
+}
+
+func (s *IdempotencyStore) Save(ctx context.Context, key string, res utils.StoredResponse, ttl time.Duration) error {
+	if s.client == nil {
+		return errors.New(cache.RedisNotAvailableError)
+	}
+
+	p, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+
+	return s.client.Set(ctx, s.prefix+key, p, ttl).Err()
+}
+
+func (s *IdempotencyStore) Release(ctx context.Context, key string) error {
+	if s.client == nil {
+		return errors.New(cache.RedisNotAvailableError)
+	}
+
+	return s.client.Del(ctx, s.prefix+key).Err()
+}
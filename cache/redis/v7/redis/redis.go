@@ -10,9 +10,14 @@ import (
 	"time"
 
 	"github.com/4books-sparta/utils/cache"
+	"github.com/4books-sparta/utils/correlation"
 	"github.com/4books-sparta/utils/logging"
 
+	"github.com/4books-sparta/utils/tracing"
+
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -101,6 +106,11 @@ func RemoveKeys(c redis.UniversalClient, startWith string) error {
 }
 
 func Store(c redis.UniversalClient, key string, value interface{}, seconds int, rep logging.ErrorReporter) error {
+	return StoreCtx(context.Background(), c, key, value, seconds, rep)
+}
+
+// StoreCtx is Store tracing the write as child of the context's span
+func StoreCtx(ctx context.Context, c redis.UniversalClient, key string, value interface{}, seconds int, rep logging.ErrorReporter) error {
 	if value == nil {
 		//Skip
 		return nil
@@ -116,12 +126,16 @@ func Store(c redis.UniversalClient, key string, value interface{}, seconds int,
 		return err
 	}
 
+	//The write outlives the caller, only the span and the request id are kept
+	ctx = trace.ContextWithSpanContext(correlation.WithRequestID(context.Background(), correlation.FromContext(ctx)), trace.SpanContextFromContext(ctx))
 	go func() {
+		_, span := startSpan(ctx, "SET", key)
 		err := c.Set(context.Background(), key, string(p), time.Duration(seconds)*time.Second).Err()
+		tracing.End(span, err)
 		if err != nil {
 			fmt.Println("REDIS store error: ", key)
 			//Unmanaged error
-			rep.Report(err, "redis-store-error", "key", key)
+			logging.ReportCtx(ctx, rep, err, "redis-store-error", "key", key)
 		}
 	}()
 
@@ -221,7 +235,15 @@ func Get(ctx context.Context, c redis.UniversalClient, key string, dest interfac
 		return errors.New(cache.RedisSkipRequestedError)
 	}
 
+	_, span := startSpan(ctx, "GET", key)
 	p, err := c.Get(context.Background(), key).Bytes()
+	span.SetAttributes(attribute.Bool("cache.hit", err == nil))
+	if errors.Is(err, redis.Nil) {
+		//A miss is not a failure
+		span.End()
+		return err
+	}
+	tracing.End(span, err)
 	if err != nil {
 		return err
 	}
@@ -291,3 +313,11 @@ func NewClient(config *Config) (redis.UniversalClient, error) {
 		WriteTimeout: defOptions.WriteTimeout,
 	}), nil
 }
+
+func startSpan(ctx context.Context, op string, key string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "redis "+op, trace.SpanKindClient,
+		attribute.String("db.system", "redis"),
+		attribute.String("db.operation.name", op),
+		attribute.String("db.redis.key", key),
+	)
+}
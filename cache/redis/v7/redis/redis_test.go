@@ -0,0 +1,124 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/4books-sparta/utils/tracing"
+)
+
+// fakeRedis answers GET and SET from a map, enough for the helpers of the package
+func fakeRedis(t *testing.T, data map[string]string) redis.UniversalClient {
+	s := &fakeStore{data: data}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeRedis(conn, s)
+		}
+	}()
+
+	c := redis.NewClient(&redis.Options{Addr: l.Addr().String(), Protocol: 2, DisableIdentity: true})
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+type fakeStore struct {
+	mu   sync.Mutex
+	data map[string]string
+}
+
+func serveFakeRedis(conn net.Conn, s *fakeStore) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		var reply string
+		s.mu.Lock()
+		switch strings.ToUpper(args[0]) {
+		case "GET":
+			if v, ok := s.data[args[1]]; ok {
+				reply = "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+			} else {
+				reply = "$-1\r\n"
+			}
+		case "SET":
+			s.data[args[1]] = args[2]
+			reply = "+OK\r\n"
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		s.mu.Unlock()
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, strings.TrimSuffix(arg, "\r\n"))
+	}
+
+	return args, nil
+}
+
+func TestGetSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracing.Enable(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)), nil)
+	defer tracing.Disable()
+
+	c := fakeRedis(t, map[string]string{"book:1": `{"title":"Book"}`})
+
+	var dest map[string]string
+	assert.Nil(t, Get(context.Background(), c, "book:1", &dest))
+	assert.Equal(t, "Book", dest["title"])
+	assert.ErrorIs(t, Get(context.Background(), c, "book:2", &dest), redis.Nil)
+
+	spans := exporter.GetSpans()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+	assert.Equal(t, "redis GET", spans[0].Name)
+	assert.Contains(t, spans[0].Attributes, attribute.String("db.redis.key", "book:1"))
+	assert.Contains(t, spans[0].Attributes, attribute.Bool("cache.hit", true))
+	assert.Contains(t, spans[1].Attributes, attribute.Bool("cache.hit", false))
+	assert.NotEqual(t, codes.Error, spans[1].Status.Code, "a miss is not a failure")
+}
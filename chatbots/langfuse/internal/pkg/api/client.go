@@ -40,9 +40,9 @@ func New() *Client {
 	}
 }
 
-func (c *Client) Ingestion(_ context.Context, req *Ingestion, res *IngestionResponse) error {
+func (c *Client) Ingestion(ctx context.Context, req *Ingestion, res *IngestionResponse) error {
 	ep, _ := req.Path()
-	return c.restClient.Post(ep, req, res)
+	return c.restClient.PostCtx(ctx, ep, req, res)
 }
 
 func basicAuth(publicKey, secretKey string) string {
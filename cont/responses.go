@@ -1,5 +1,9 @@
 package cont
 
+import (
+	"iter"
+)
+
 type SkillBooksMatchResponse struct {
 	Matches map[uint32]int `json:"matches"`
 }
@@ -23,3 +27,21 @@ type ResourceStats struct {
 	Resources int
 	Users     int
 }
+
+// SitemapEntry is a SitemapRow together with its language, used to stream sitemaps row by row
+type SitemapEntry struct {
+	Lang string `json:"lang" xml:"lang,attr"`
+	*SitemapRow
+}
+
+func (s SitemapRows) Entries() iter.Seq[SitemapEntry] {
+	return func(yield func(SitemapEntry) bool) {
+		for lang, rows := range s {
+			for _, r := range rows {
+				if !yield(SitemapEntry{Lang: lang, SitemapRow: r}) {
+					return
+				}
+			}
+		}
+	}
+}
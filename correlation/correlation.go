@@ -0,0 +1,103 @@
+package correlation
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// HeaderRequestID is the HTTP header carrying the request id
+	HeaderRequestID = "X-Request-ID"
+	// MessageKey is the Kafka header and Pub/Sub attribute carrying the request id
+	MessageKey = "x-request-id"
+	CtxKey     = "req-correlation-id"
+
+	maxIdLength = 128
+)
+
+func NewID() string {
+	return uuid.New().String()
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+
+	return context.WithValue(ctx, CtxKey, id)
+}
+
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(CtxKey).(string)
+	return id
+}
+
+// Ensure returns a context holding a request id, creating one when missing
+func Ensure(ctx context.Context) (context.Context, string) {
+	if id := FromContext(ctx); id != "" {
+		return ctx, id
+	}
+
+	id := NewID()
+	return WithRequestID(ctx, id), id
+}
+
+// IsValid rejects ids that could be used to forge log lines or headers
+func IsValid(id string) bool {
+	if id == "" || len(id) > maxIdLength {
+		return false
+	}
+	for _, c := range id {
+		isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !isAlnum && c != '-' && c != '_' && c != '.' && c != ':' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ServerBefore accepts the caller's X-Request-ID, or creates a new one, and stores it in the context
+func ServerBefore(ctx context.Context, req *http.Request) context.Context {
+	id := req.Header.Get(HeaderRequestID)
+	if !IsValid(id) {
+		id = NewID()
+	}
+
+	return WithRequestID(ctx, id)
+}
+
+// ServerAfter echoes the request id to the caller
+func ServerAfter(ctx context.Context, w http.ResponseWriter) context.Context {
+	if id := FromContext(ctx); id != "" {
+		w.Header().Set(HeaderRequestID, id)
+	}
+
+	return ctx
+}
+
+func InjectHeader(ctx context.Context, h http.Header) {
+	if id := FromContext(ctx); id != "" {
+		h.Set(HeaderRequestID, id)
+	}
+}
+
+// Attributes returns the Pub/Sub attributes carrying the request id, nil when there is none
+func Attributes(ctx context.Context) map[string]string {
+	id := FromContext(ctx)
+	if id == "" {
+		return nil
+	}
+
+	return map[string]string{MessageKey: id}
+}
+
+func FromAttributes(ctx context.Context, attrs map[string]string) context.Context {
+	if id := attrs[MessageKey]; IsValid(id) {
+		return WithRequestID(ctx, id)
+	}
+
+	return ctx
+}
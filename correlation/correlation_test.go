@@ -0,0 +1,51 @@
+package correlation
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerBeforeAcceptsValidIds(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(HeaderRequestID, "abc-123")
+	assert.Equal(t, "abc-123", FromContext(ServerBefore(context.Background(), req)))
+
+	for _, id := range []string{"", "abc\nlevel=error", strings.Repeat("a", maxIdLength+1)} {
+		req.Header.Set(HeaderRequestID, id)
+		got := FromContext(ServerBefore(context.Background(), req))
+		assert.NotEqual(t, id, got)
+		assert.True(t, IsValid(got), "a new id replaces %q", id)
+	}
+}
+
+func TestServerAfterEchoesTheId(t *testing.T) {
+	w := httptest.NewRecorder()
+	ServerAfter(context.Background(), w)
+	assert.Empty(t, w.Header().Get(HeaderRequestID))
+
+	ServerAfter(WithRequestID(context.Background(), "abc-123"), w)
+	assert.Equal(t, "abc-123", w.Header().Get(HeaderRequestID))
+}
+
+func TestEnsureKeepsTheId(t *testing.T) {
+	ctx, id := Ensure(context.Background())
+	assert.NotEmpty(t, id)
+
+	_, again := Ensure(ctx)
+	assert.Equal(t, id, again)
+}
+
+func TestAttributesRoundTrip(t *testing.T) {
+	assert.Nil(t, Attributes(context.Background()))
+
+	attrs := Attributes(WithRequestID(context.Background(), "abc-123"))
+	assert.Equal(t, "abc-123", FromContext(FromAttributes(context.Background(), attrs)))
+
+	attrs[MessageKey] = "abc 123"
+	assert.Empty(t, FromContext(FromAttributes(context.Background(), attrs)))
+}
@@ -0,0 +1,206 @@
+package utils
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CORSCtxKey = "req-cors"
+)
+
+type CORSPolicy struct {
+	// AllowedOrigins lists exact origins, "*" to allow any origin or "*.example.com" to allow its subdomains
+	AllowedOrigins []string
+	// AllowOriginFunc is consulted for the origins not matched by AllowedOrigins
+	AllowOriginFunc  func(origin string) bool
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration
+	// Routes overrides the policy for the paths starting with the key, the longest prefix wins
+	Routes map[string]*CORSPolicy
+}
+
+// DefaultCORSPolicy allows any origin without credentials
+func DefaultCORSPolicy() *CORSPolicy {
+	return &CORSPolicy{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
+		AllowedHeaders: []string{"Content-Type", "Accept-Language", "Authorization", "X-Cms-Version", "x-client-type", "x-client-version"},
+	}
+}
+
+type corsRequest struct {
+	policy *CORSPolicy
+	origin string
+}
+
+func (p *CORSPolicy) forPath(path string) *CORSPolicy {
+	best := ""
+	ret := p
+	for prefix, rp := range p.Routes {
+		if strings.HasPrefix(path, prefix) && len(prefix) > len(best) {
+			best = prefix
+			ret = rp
+		}
+	}
+
+	return ret
+}
+
+func (p *CORSPolicy) anyOrigin() bool {
+	for _, o := range p.AllowedOrigins {
+		if o == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchOrigin tells if the origin may read the responses, listed tells if an entry other than "*" matched it.
+// Only listed origins are echoed and may send credentials: any website could otherwise read the answers meant for the user
+func (p *CORSPolicy) matchOrigin(origin string) (allowed bool, listed bool) {
+	if origin == "" {
+		return false, false
+	}
+
+	wildcard := false
+	for _, o := range p.AllowedOrigins {
+		if o == "*" {
+			wildcard = true
+			continue
+		}
+		if strings.EqualFold(o, origin) || matchSubdomainOrigin(o, origin) {
+			return true, true
+		}
+	}
+
+	if p.AllowOriginFunc != nil && p.AllowOriginFunc(origin) {
+		return true, true
+	}
+
+	return wildcard, false
+}
+
+// matchSubdomainOrigin matches "*.example.com", https only, or "scheme://*.example.com[:port]"
+func matchSubdomainOrigin(pattern, origin string) bool {
+	scheme := "https"
+	if i := strings.Index(pattern, "://"); i >= 0 {
+		scheme, pattern = pattern[:i], pattern[i+3:]
+	}
+	if !strings.HasPrefix(pattern, "*.") {
+		return false
+	}
+	host, port := pattern, ""
+	if h, pp, err := net.SplitHostPort(pattern); err == nil {
+		host, port = h, pp
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || !strings.EqualFold(u.Scheme, scheme) || u.Path != "" || u.Port() != port {
+		return false
+	}
+
+	return strings.HasSuffix(strings.ToLower(u.Hostname()), strings.ToLower(host[1:]))
+}
+
+func (p *CORSPolicy) write(h http.Header, origin string, preflight bool) {
+	if p.anyOrigin() && !p.AllowCredentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		//The answer depends on the caller, caches must key on it
+		addVary(h, "Origin")
+		allowed, listed := p.matchOrigin(origin)
+		if !allowed {
+			return
+		}
+		if !listed {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+			if p.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+	}
+
+	h.Set("Access-Control-Allow-Methods", strings.Join(p.AllowedMethods, ", "))
+	h.Set("Access-Control-Allow-Headers", strings.Join(p.AllowedHeaders, ", "))
+
+	if !preflight && len(p.ExposedHeaders) > 0 {
+		h.Set("Access-Control-Expose-Headers", strings.Join(p.ExposedHeaders, ", "))
+	}
+	if preflight && p.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+	}
+}
+
+func addVary(h http.Header, v string) {
+	for _, existing := range h.Values("Vary") {
+		for _, e := range strings.Split(existing, ",") {
+			if strings.EqualFold(strings.TrimSpace(e), v) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", v)
+}
+
+// Preflight answers an OPTIONS request following the policy
+func (p *CORSPolicy) Preflight(w http.ResponseWriter, req *http.Request) {
+	p.forPath(req.URL.Path).write(w.Header(), req.Header.Get("Origin"), true)
+	w.WriteHeader(200)
+}
+
+func (f *Forwarder) WithCORS(p *CORSPolicy) *Forwarder {
+	f.cors = p
+	return f
+}
+
+func (f *Forwarder) corsPolicy() *CORSPolicy {
+	if f.cors == nil {
+		return DefaultCORSPolicy()
+	}
+
+	return f.cors
+}
+
+func (f *Forwarder) Preflight(w http.ResponseWriter, req *http.Request) {
+	f.corsPolicy().Preflight(w, req)
+}
+
+func (f *Forwarder) plugCORS(ctx context.Context, req *http.Request) context.Context {
+	return context.WithValue(ctx, CORSCtxKey, corsRequest{
+		policy: f.corsPolicy().forPath(req.URL.Path),
+		origin: req.Header.Get("Origin"),
+	})
+}
+
+func writeCORS(ctx context.Context, w http.ResponseWriter) context.Context {
+	setCORS(ctx, w)
+
+	return ctx
+}
+
+func Preflight(w http.ResponseWriter, req *http.Request) {
+	DefaultCORSPolicy().Preflight(w, req)
+}
+
+func setCORS(ctx context.Context, w http.ResponseWriter) {
+	cr, ok := ctx.Value(CORSCtxKey).(corsRequest)
+	if !ok {
+		DefaultCORSPolicy().write(w.Header(), "", false)
+		return
+	}
+
+	cr.policy.write(w.Header(), cr.origin, false)
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func preflight(p *CORSPolicy, path, origin string) http.Header {
+	req := httptest.NewRequest(http.MethodOptions, path, nil)
+	req.Header.Set("Origin", origin)
+	w := httptest.NewRecorder()
+	p.Preflight(w, req)
+
+	return w.Header()
+}
+
+func TestCORSPolicyEchoesAllowedOrigins(t *testing.T) {
+	p := &CORSPolicy{
+		AllowedOrigins:   []string{"https://app.4books.com", "*.cms.4books.com"},
+		AllowCredentials: true,
+		MaxAge:           time.Hour,
+		Routes: map[string]*CORSPolicy{
+			"/public": DefaultCORSPolicy(),
+		},
+	}
+
+	h := preflight(p, "/users", "https://app.4books.com")
+	assert.Equal(t, "https://app.4books.com", h.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", h.Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "3600", h.Get("Access-Control-Max-Age"))
+	assert.Equal(t, "Origin", h.Get("Vary"))
+
+	h = preflight(p, "/users", "https://it.cms.4books.com")
+	assert.Equal(t, "https://it.cms.4books.com", h.Get("Access-Control-Allow-Origin"))
+
+	h = preflight(p, "/users", "https://evil.com")
+	assert.Empty(t, h.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", h.Get("Vary"))
+
+	h = preflight(p, "/public/books", "https://evil.com")
+	assert.Equal(t, "*", h.Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, h.Get("Vary"))
+}
+
+func TestCORSPolicyNeverCredentialsAnyOrigin(t *testing.T) {
+	p := &CORSPolicy{
+		AllowedOrigins:   []string{"*", "*.cms.4books.com"},
+		AllowCredentials: true,
+	}
+
+	h := preflight(p, "/users", "https://evil.com")
+	assert.Equal(t, "*", h.Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, h.Get("Access-Control-Allow-Credentials"))
+
+	h = preflight(p, "/users", "https://it.cms.4books.com")
+	assert.Equal(t, "https://it.cms.4books.com", h.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", h.Get("Access-Control-Allow-Credentials"))
+
+	h = preflight(p, "/users", "http://it.cms.4books.com")
+	assert.Empty(t, h.Get("Access-Control-Allow-Credentials"), "subdomain entries are https only")
+
+	h = http.Header{}
+	h.Set("Vary", "Accept-Encoding, Origin")
+	p.write(h, "https://it.cms.4books.com", false)
+	assert.Equal(t, []string{"Accept-Encoding, Origin"}, h.Values("Vary"))
+}
+
+func TestCORSPolicyEchoesOriginsWithoutCredentials(t *testing.T) {
+	p := &CORSPolicy{AllowedOrigins: []string{"https://app.4books.com", "http://*.local.4books.com:8080"}}
+
+	h := preflight(p, "/users", "https://app.4books.com")
+	assert.Equal(t, "https://app.4books.com", h.Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, h.Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "Origin", h.Get("Vary"))
+
+	h = preflight(p, "/users", "http://it.local.4books.com:8080")
+	assert.Equal(t, "http://it.local.4books.com:8080", h.Get("Access-Control-Allow-Origin"))
+
+	h = preflight(p, "/users", "http://it.local.4books.com:9090")
+	assert.Empty(t, h.Get("Access-Control-Allow-Origin"), "subdomain entries match the port")
+}
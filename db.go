@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -25,6 +26,10 @@ type DbConfig struct {
 	Timeout  time.Duration
 	MaxIdle  int
 	MaxOpen  int
+	// Replicas are the read replica hosts, "host" or "host:port", sharing the credentials of the primary
+	Replicas []string
+	// ReplicaCheckInterval is how often the replicas are pinged to eject the failing ones
+	ReplicaCheckInterval time.Duration
 }
 
 type SqlDatabase struct {
@@ -69,9 +74,43 @@ func NewDatabase(c DbConfig) (*SqlDatabase, error) {
 	sqlDB.SetMaxOpenConns(c.MaxOpen)
 	sqlDB.SetConnMaxLifetime(c.Timeout)
 
+	if len(c.Replicas) > 0 {
+		if err := useReplicas(db, c); err != nil {
+			return nil, err
+		}
+	}
+
 	return &SqlDatabase{db}, nil
 }
 
+// PingContext checks that the database is reachable
+func (db *SqlDatabase) PingContext(ctx context.Context) error {
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.PingContext(ctx)
+}
+
+// Close stops the replica health checks and closes the connection pools
+func (db *SqlDatabase) Close() error {
+	var err error
+	if p, ok := db.Config.Plugins[replicaPolicyName].(*replicaPolicy); ok {
+		err = p.close()
+	}
+
+	sqlDB, dbErr := db.DB.DB()
+	if dbErr != nil {
+		return dbErr
+	}
+	if cErr := sqlDB.Close(); cErr != nil {
+		return cErr
+	}
+
+	return err
+}
+
 func GetDbConfig() DbConfig {
 	return DbConfig{
 		Vendor:   viper.GetString("db_vendor"),
@@ -84,6 +123,9 @@ func GetDbConfig() DbConfig {
 		Timeout:  time.Duration(viper.GetInt("db_timeout")) * time.Minute,
 		MaxIdle:  viper.GetInt("db_idle"),
 		MaxOpen:  viper.GetInt("db_open"),
+		Replicas: viper.GetStringSlice("db_replicas"),
+
+		ReplicaCheckInterval: viper.GetDuration("db_replica_check_interval"),
 	}
 }
 
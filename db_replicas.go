@@ -0,0 +1,237 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+const (
+	PrimaryDbCtxKey = "req-db-primary"
+
+	DefaultReplicaCheckInterval = 10 * time.Second
+
+	replicaPolicyName = "utils:replica_policy"
+)
+
+// WithPrimaryDb routes the reads of ctx to the primary, e.g. to read the rows just written
+func WithPrimaryDb(ctx context.Context) context.Context {
+	return context.WithValue(ctx, PrimaryDbCtxKey, true)
+}
+
+func IsPrimaryDbContext(ctx context.Context) bool {
+	v, ok := ctx.Value(PrimaryDbCtxKey).(bool)
+	if !ok {
+		return false
+	}
+
+	return v
+}
+
+// ReplicaStatus reports whether each replica host is serving reads
+func (db *SqlDatabase) ReplicaStatus() map[string]bool {
+	p, ok := db.Config.Plugins[replicaPolicyName].(*replicaPolicy)
+	if !ok {
+		return nil
+	}
+
+	return p.status()
+}
+
+// replicaPolicy balances the reads among the healthy replicas, and falls back to the primary when none is
+type replicaPolicy struct {
+	primary  gorm.ConnPool
+	replicas []*replica
+	next     uint64
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type replica struct {
+	host    string
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+func (p *replicaPolicy) Name() string {
+	return replicaPolicyName
+}
+
+func (p *replicaPolicy) Initialize(*gorm.DB) error {
+	return nil
+}
+
+func (p *replicaPolicy) Resolve(pools []gorm.ConnPool) gorm.ConnPool {
+	healthy := make([]gorm.ConnPool, 0, len(pools))
+	for _, r := range p.replicas {
+		if r.healthy.Load() {
+			healthy = append(healthy, r.db)
+		}
+	}
+	if len(healthy) == 0 {
+		return p.primary
+	}
+
+	n := atomic.AddUint64(&p.next, 1)
+	return healthy[n%uint64(len(healthy))]
+}
+
+func (p *replicaPolicy) check(timeout time.Duration) {
+	var wg sync.WaitGroup
+	for _, r := range p.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			r.healthy.Store(r.db.PingContext(ctx) == nil)
+		}(r)
+	}
+	wg.Wait()
+}
+
+func (p *replicaPolicy) watch(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-t.C:
+			p.check(interval / 2)
+		}
+	}
+}
+
+// close stops the health checks and closes the replica pools
+func (p *replicaPolicy) close() error {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+
+	var err error
+	for _, r := range p.replicas {
+		if cErr := r.db.Close(); cErr != nil {
+			err = cErr
+		}
+	}
+
+	return err
+}
+
+func (p *replicaPolicy) status() map[string]bool {
+	ret := make(map[string]bool, len(p.replicas))
+	for _, r := range p.replicas {
+		ret[r.host] = r.healthy.Load()
+	}
+
+	return ret
+}
+
+func (c DbConfig) forReplica(hostport string) DbConfig {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		c.Host = hostport
+		return c
+	}
+
+	c.Host = host
+	if p, err := strconv.Atoi(port); err == nil {
+		c.Port = uint16(p)
+	}
+
+	return c
+}
+
+// useReplicas sends the reads to the replicas through dbresolver, writes and transactions stay on the primary
+func useReplicas(db *gorm.DB, c DbConfig) error {
+	primary, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	//A replica down at boot is ejected instead of failing the service
+	pinging := !db.Config.DisableAutomaticPing
+	db.Config.DisableAutomaticPing = true
+	defer func() {
+		db.Config.DisableAutomaticPing = !pinging
+	}()
+
+	interval := c.ReplicaCheckInterval
+	if interval <= 0 {
+		interval = DefaultReplicaCheckInterval
+	}
+
+	p := &replicaPolicy{primary: primary, stop: make(chan struct{})}
+	dialectors := make([]gorm.Dialector, 0, len(c.Replicas))
+	for _, host := range c.Replicas {
+		rdb, err := gorm.Open(postgres.Open(c.forReplica(host).connectUrl()), &gorm.Config{
+			Logger:               db.Config.Logger,
+			DisableAutomaticPing: true,
+		})
+		if err != nil {
+			return err
+		}
+		sqlDB, err := rdb.DB()
+		if err != nil {
+			return err
+		}
+		sqlDB.SetMaxIdleConns(c.MaxIdle)
+		sqlDB.SetMaxOpenConns(c.MaxOpen)
+		sqlDB.SetConnMaxLifetime(c.Timeout)
+
+		r := &replica{host: host, db: sqlDB}
+		p.replicas = append(p.replicas, r)
+		dialectors = append(dialectors, postgres.New(postgres.Config{Conn: sqlDB}))
+	}
+
+	err = db.Use(dbresolver.Register(dbresolver.Config{
+		Replicas: dialectors,
+		Policy:   p,
+	}))
+	if err != nil {
+		return err
+	}
+	if err := db.Use(p); err != nil {
+		return err
+	}
+
+	if err := registerForcePrimary(db); err != nil {
+		return err
+	}
+
+	p.check(interval / 2)
+	//Stopped by SqlDatabase.Close
+	go p.watch(interval)
+
+	return nil
+}
+
+// registerForcePrimary routes again to the primary the reads whose context asks for it
+func registerForcePrimary(db *gorm.DB) error {
+	forcePrimary := func(tx *gorm.DB) {
+		if tx.Statement.Context != nil && IsPrimaryDbContext(tx.Statement.Context) {
+			dbresolver.Write.ModifyStatement(tx.Statement)
+		}
+	}
+
+	//Between the choice of the replica and the statement
+	if err := db.Callback().Query().After("gorm:db_resolver").Before("gorm:query").Register("utils:force_primary", forcePrimary); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().After("gorm:db_resolver").Before("gorm:row").Register("utils:force_primary", forcePrimary); err != nil {
+		return err
+	}
+
+	return db.Callback().Raw().After("gorm:db_resolver").Before("gorm:raw").Register("utils:force_primary", forcePrimary)
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+func TestReplicaPolicyEjectsUnhealthyReplicas(t *testing.T) {
+	primary := new(sql.DB)
+	a := &replica{host: "replica-a", db: new(sql.DB)}
+	b := &replica{host: "replica-b", db: new(sql.DB)}
+	a.healthy.Store(true)
+	p := &replicaPolicy{primary: primary, replicas: []*replica{a, b}}
+
+	for i := 0; i < 3; i++ {
+		assert.Same(t, a.db, p.Resolve(nil))
+	}
+	assert.Equal(t, map[string]bool{"replica-a": true, "replica-b": false}, p.status())
+
+	a.healthy.Store(false)
+	assert.Same(t, primary, p.Resolve(nil))
+}
+
+func TestReplicaConfig(t *testing.T) {
+	c := DbConfig{Host: "primary", Port: 5432}
+
+	assert.Equal(t, "replica", c.forReplica("replica").Host)
+	assert.Equal(t, uint16(5432), c.forReplica("replica").Port)
+	assert.Equal(t, uint16(5433), c.forReplica("replica:5433").Port)
+}
+
+func TestReplicaPolicyStopsWatching(t *testing.T) {
+	p := &replicaPolicy{stop: make(chan struct{})}
+	stopped := make(chan struct{})
+	go func() {
+		p.watch(time.Millisecond)
+		close(stopped)
+	}()
+
+	assert.Nil(t, p.close())
+	assert.Nil(t, p.close(), "closing twice is harmless")
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("the watch goroutine is still running")
+	}
+}
+
+func TestPrimaryDbContextRoutesReadsToThePrimary(t *testing.T) {
+	db, primary := newRecordingDatabase(t)
+	replicaDB, replicaDriver := openRecordingDriver(t)
+
+	r := &replica{host: "replica", db: replicaDB}
+	r.healthy.Store(true)
+	pool, _ := db.DB.DB()
+	p := &replicaPolicy{primary: pool, replicas: []*replica{r}}
+	assert.Nil(t, db.Use(dbresolver.Register(dbresolver.Config{
+		Replicas: []gorm.Dialector{postgres.New(postgres.Config{Conn: replicaDB})},
+		Policy:   p,
+	})))
+	assert.Nil(t, registerForcePrimary(db.DB))
+
+	read := func(ctx context.Context) {
+		var books []optimisticBook
+		assert.Nil(t, db.Conn(ctx).Find(&books).Error)
+		var n int
+		assert.Nil(t, db.Conn(ctx).Raw("SELECT count(*) FROM optimistic_books").Scan(&n).Error)
+		var id uint
+		assert.ErrorIs(t, db.Conn(ctx).Model(&optimisticBook{}).Select("id").Row().Scan(&id), sql.ErrNoRows)
+	}
+
+	read(context.Background())
+	assert.Len(t, replicaDriver.statements(), 3)
+	assert.Empty(t, primary.statements())
+
+	read(WithPrimaryDb(context.Background()))
+	assert.Len(t, replicaDriver.statements(), 3)
+	assert.Len(t, primary.statements(), 3)
+}
@@ -9,15 +9,55 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+const (
+	ProbeStatusDown = uint8(0)
+	ProbeStatusUp   = uint8(1)
+)
+
 type ProbeResponse struct {
 	Status uint8 `json:"status"`
+	// Checks reports the status of each dependency
+	Checks map[string]ProbeCheck `json:"checks,omitempty"`
+}
+
+type ProbeCheck struct {
+	Status uint8 `json:"status"`
+	// Critical checks set the overall status down when they fail
+	Critical  bool    `json:"critical"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
 }
 
-func MakeProbeEndpoint() endpoint.Endpoint {
+// Prober reports the status of the dependencies, e.g. health.HealthRegistry
+type Prober interface {
+	Probe(ctx context.Context) ProbeResponse
+}
+
+// MakeProbeEndpoint merges the probes of every p, the status is down when any of them is down.
+// Without probers the status is always up
+func MakeProbeEndpoint(p ...Prober) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		return ProbeResponse{
-			Status: 1,
-		}, nil
+		res := ProbeResponse{
+			Status: ProbeStatusUp,
+		}
+		for _, prober := range p {
+			if prober == nil {
+				continue
+			}
+
+			pr := prober.Probe(ctx)
+			if pr.Status == ProbeStatusDown {
+				res.Status = ProbeStatusDown
+			}
+			for name, check := range pr.Checks {
+				if res.Checks == nil {
+					res.Checks = make(map[string]ProbeCheck)
+				}
+				res.Checks[name] = check
+			}
+		}
+
+		return res, nil
 	}
 }
 
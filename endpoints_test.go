@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type staticProber ProbeResponse
+
+func (p staticProber) Probe(context.Context) ProbeResponse {
+	return ProbeResponse(p)
+}
+
+func TestProbeEndpointRunsEveryProber(t *testing.T) {
+	db := staticProber{Status: ProbeStatusUp, Checks: map[string]ProbeCheck{"db": {Status: ProbeStatusUp}}}
+	redis := staticProber{Status: ProbeStatusDown, Checks: map[string]ProbeCheck{"redis": {Status: ProbeStatusDown, Critical: true}}}
+
+	res, err := MakeProbeEndpoint(db, redis)(context.Background(), nil)
+	assert.Nil(t, err)
+	pr := res.(ProbeResponse)
+	assert.Equal(t, ProbeStatusDown, pr.Status)
+	assert.Len(t, pr.Checks, 2)
+
+	res, _ = MakeProbeEndpoint()(context.Background(), nil)
+	assert.Equal(t, ProbeResponse{Status: ProbeStatusUp}, res)
+}
@@ -2,11 +2,15 @@ package utils
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 
 	"gopkg.in/go-playground/validator.v9"
+
+	"github.com/4books-sparta/utils/i18n"
 )
 
 const (
@@ -35,13 +39,37 @@ const (
 	ErrorSlugPresent                  = "slug-not-unique"
 	ErrorConcurrency                  = "record-was-already-changed"
 	ErrorSubscriptionItemPlanNotFound = "subscription-item-plan-not-found"
+	ErrorValidationFailed             = "validation-failed"
+	ErrorInvalidParameters            = "invalid-parameters"
 )
 
+// WithErrorKey is implemented by errors exposing a machine readable key, such as ErrorBookNotFound
+type WithErrorKey interface {
+	ErrorKey() string
+}
+
+// WithMessageArgs is implemented by errors interpolating values in their localized message
+type WithMessageArgs interface {
+	MessageArgs() []interface{}
+}
+
+// WithDetails is implemented by errors carrying field level messages
+type WithDetails interface {
+	Details() map[string]string
+}
+
 type NotFound struct {
 	Err error
 }
 
+// Error is ErrorResourceNotFound, the key of the cause is exposed by the envelope.
+// A 404 of another service keeps the remote message, as the other rehydrated errors do.
 func (e NotFound) Error() string {
+	var remote RemoteError
+	if errors.As(e.Err, &remote) {
+		return remote.Error()
+	}
+
 	return ErrorResourceNotFound
 }
 
@@ -49,6 +77,10 @@ func (e NotFound) Code() int {
 	return 404
 }
 
+func (e NotFound) Unwrap() error {
+	return e.Err
+}
+
 type Forbidden struct {
 	Err error
 }
@@ -65,6 +97,10 @@ func (e Forbidden) Code() int {
 	return 403
 }
 
+func (e Forbidden) Unwrap() error {
+	return e.Err
+}
+
 type InvalidRequestError struct {
 	Err error
 }
@@ -81,6 +117,10 @@ func (e InvalidRequestError) Code() int {
 	return http.StatusUnprocessableEntity
 }
 
+func (e InvalidRequestError) Unwrap() error {
+	return e.Err
+}
+
 type PreconditionFailedError struct {
 	Err error
 }
@@ -97,8 +137,36 @@ func (e PreconditionFailedError) Code() int {
 	return http.StatusPreconditionFailed
 }
 
+func (e PreconditionFailedError) Unwrap() error {
+	return e.Err
+}
+
+// ConflictError is returned when a record was changed by someone else since it was read
+type ConflictError struct {
+	Table string
+	Err   error
+}
+
+func (e ConflictError) Error() string {
+	if e.Err == nil {
+		return ErrorConcurrency
+	}
+
+	return e.Err.Error()
+}
+
+func (e ConflictError) Code() int {
+	return http.StatusConflict
+}
+
+func (e ConflictError) Unwrap() error {
+	return e.Err
+}
+
 type ValidationError struct {
 	Children validator.ValidationErrors
+	// Locale translates the details, when empty they are the untranslated rule names
+	Locale Locale
 }
 
 func (v ValidationError) Error() string {
@@ -115,13 +183,173 @@ func (v ValidationError) Code() int {
 	return http.StatusUnprocessableEntity
 }
 
-func (v ValidationError) MarshalJSON() ([]byte, error) {
+func (v ValidationError) ErrorKey() string {
+	return ErrorValidationFailed
+}
+
+func (v ValidationError) Details() map[string]string {
 	content := make(map[string]string)
 	for _, err := range v.Children {
-		content[err.Field()] = fmt.Sprintf("failed '%s' validation", err.Tag())
+		if v.Locale == "" {
+			content[err.Field()] = fmt.Sprintf("failed '%s' validation", err.Tag())
+			continue
+		}
+		content[err.Field()] = ValidationMessage(v.Locale, err)
+	}
+
+	return content
+}
+
+func (v ValidationError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.Details())
+}
+
+// ParameterErrors maps the malformed query or path parameters to their messages
+type ParameterErrors map[string]string
+
+func (p ParameterErrors) Error() string {
+	keys := make([]string, 0, len(p))
+	for k := range p {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(fmt.Sprintf("%s=%s|", k, p[k]))
 	}
 
-	return json.Marshal(content)
+	return b.String()
+}
+
+func (p ParameterErrors) ErrorKey() string {
+	return ErrorInvalidParameters
+}
+
+func (p ParameterErrors) Details() map[string]string {
+	return p
+}
+
+// ErrorEnvelope is the body written by the Forwarder error encoder and parsed back by ServiceResponse2Error
+type ErrorEnvelope struct {
+	Code      int               `json:"code"`
+	Message   string            `json:"message"`
+	Key       string            `json:"error,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	RequestId string            `json:"request_id,omitempty"`
+	// LocalizedMessage translates Key in the locale negotiated with the client
+	LocalizedMessage string `json:"localized_message,omitempty"`
+}
+
+func NewErrorEnvelope(err error, requestId string) ErrorEnvelope {
+	env := ErrorEnvelope{
+		Code:      http.StatusBadRequest,
+		Message:   err.Error(),
+		Key:       innermostError(err).Error(),
+		RequestId: requestId,
+	}
+
+	var c WithCode
+	if errors.As(err, &c) {
+		env.Code = c.Code()
+	}
+	var k WithErrorKey
+	if errors.As(err, &k) && k.ErrorKey() != "" {
+		env.Key = k.ErrorKey()
+	}
+	var d WithDetails
+	if errors.As(err, &d) {
+		env.Details = d.Details()
+	}
+
+	return env
+}
+
+// Localize sets LocalizedMessage from the first locale of the chain translating the key
+func (env *ErrorEnvelope) Localize(err error, chain []Locale) {
+	langs := make([]string, 0, len(chain))
+	for _, l := range chain {
+		langs = append(langs, l.ToString())
+	}
+
+	var args []interface{}
+	var a WithMessageArgs
+	if errors.As(err, &a) {
+		args = a.MessageArgs()
+	}
+
+	if msg, ok := i18n.Default().Translate(langs, env.Key, args...); ok {
+		env.LocalizedMessage = msg
+	}
+}
+
+// innermostError returns the root cause, which carries the key when a typed error wraps it (e.g. NotFound{Err: errors.New(ErrorBookNotFound)})
+func innermostError(err error) error {
+	for {
+		inner := errors.Unwrap(err)
+		if inner == nil {
+			return err
+		}
+		err = inner
+	}
+}
+
+// ToError rehydrates the envelope into the typed error matching its code,
+// so that errors.As keeps working across service boundaries
+func (env ErrorEnvelope) ToError() error {
+	remote := RemoteError{
+		Status:    env.Code,
+		Key:       env.Key,
+		Message:   env.Message,
+		Fields:    env.Details,
+		RequestId: env.RequestId,
+	}
+
+	switch env.Code {
+	case http.StatusNotFound:
+		return NotFound{Err: remote}
+	case http.StatusForbidden:
+		return Forbidden{Err: remote}
+	case http.StatusUnauthorized:
+		return AccessError{Err: remote}
+	case http.StatusUnprocessableEntity:
+		return InvalidRequestError{Err: remote}
+	case http.StatusPreconditionFailed:
+		return PreconditionFailedError{Err: remote}
+	case http.StatusConflict:
+		return ConflictError{Err: remote}
+	}
+
+	return remote
+}
+
+// RemoteError is an error returned by another service
+type RemoteError struct {
+	Status    int
+	Key       string
+	Message   string
+	Fields    map[string]string
+	RequestId string
+}
+
+func (e RemoteError) Error() string {
+	if e.Message == "" {
+		return e.Key
+	}
+
+	return e.Message
+}
+
+func (e RemoteError) Code() int {
+	return e.Status
+}
+
+func (e RemoteError) ErrorKey() string {
+	return e.Key
+}
+
+func (e RemoteError) Details() map[string]string {
+	return e.Fields
 }
 
 func PrintVarDump(title, i interface{}) {
@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+func errorServer(err error) *httptest.Server {
+	var e endpoint.Endpoint = func(ctx context.Context, request interface{}) (interface{}, error) {
+		return nil, err
+	}
+
+	dec := func(context.Context, *http.Request) (interface{}, error) {
+		return struct{}{}, nil
+	}
+
+	return httptest.NewServer(NewForwarder(nil).Forward(e, dec))
+}
+
+func TestErrorsRoundTrip(t *testing.T) {
+	tests := []struct {
+		err    error
+		target interface{}
+		key    string
+	}{
+		{NotFound{Err: errors.New(ErrorBookNotFound)}, &NotFound{}, ErrorBookNotFound},
+		{Forbidden{Err: errors.New(ErrorCMSRightsNeeded)}, &Forbidden{}, ErrorCMSRightsNeeded},
+		{PreconditionFailedError{}, &PreconditionFailedError{}, "precondition-failed"},
+		{AccessError{}, &AccessError{}, "authentication-failed"},
+		{InvalidRequestError{Err: errors.New(ErrorEmptyBook)}, &InvalidRequestError{}, ErrorEmptyBook},
+		{ConflictError{Table: "books"}, &ConflictError{}, ErrorConcurrency},
+	}
+
+	for _, tt := range tests {
+		srv := errorServer(tt.err)
+		err := MicroserviceClient{Url: srv.URL}.Post("/", struct{}{}, nil)
+		srv.Close()
+
+		assert.True(t, errors.As(err, tt.target), "%T", tt.err)
+
+		var remote RemoteError
+		assert.True(t, errors.As(err, &remote))
+		assert.Equal(t, tt.key, remote.ErrorKey())
+		assert.Equal(t, tt.err.(WithCode).Code(), remote.Code())
+	}
+}
+
+func TestValidationErrorDetailsRoundTrip(t *testing.T) {
+	verr := ValidateRequest(struct {
+		Slug string `json:"slug" validate:"required"`
+	}{})
+	srv := errorServer(verr)
+	defer srv.Close()
+
+	err := MicroserviceClient{Url: srv.URL}.Post("/", struct{}{}, nil)
+
+	var invalid InvalidRequestError
+	assert.True(t, errors.As(err, &invalid))
+
+	var d WithDetails
+	assert.True(t, errors.As(err, &d))
+	assert.Equal(t, map[string]string{"slug": "failed 'required' validation"}, d.Details())
+
+	var remote RemoteError
+	assert.True(t, errors.As(err, &remote))
+	assert.Equal(t, ErrorValidationFailed, remote.ErrorKey())
+}
+
+func TestValidationErrorLocalized(t *testing.T) {
+	req := struct {
+		Locale   string `json:"locale" validate:"required,locale"`
+		ContType string `json:"cont_type" validate:"cont_type"`
+		Phone    string `json:"phone" validate:"e164"`
+	}{Locale: "fr", ContType: "book", Phone: "333"}
+
+	err := ValidateRequestCtx(WithLocale(context.Background(), LocaleFromAcceptLanguage("es-ES,es;q=0.9,en;q=0.8")), req)
+	var verr ValidationError
+	assert.True(t, errors.As(err, &verr))
+	assert.Equal(t, map[string]string{
+		"locale": "locale no es un idioma soportado",
+		"phone":  "phone debe ser un número de teléfono en formato internacional, p. ej. +34612345678",
+	}, verr.Details())
+
+	b, _ := json.Marshal(verr)
+	assert.Contains(t, string(b), "idioma soportado")
+
+	assert.Nil(t, RegisterValidation("even_len", func(fl validator.FieldLevel) bool {
+		return fl.Field().Len()%2 == 0
+	}, map[Locale]string{ItLocale: "{field} deve avere lunghezza pari"}))
+	err = ValidateRequestCtx(WithLocale(context.Background(), ItLocale), struct {
+		Code string `validate:"even_len"`
+	}{Code: "abc"})
+	assert.True(t, errors.As(err, &verr))
+	assert.Equal(t, "Code deve avere lunghezza pari", verr.Details()["Code"])
+
+	err = ValidateRequest(struct {
+		Limit uint `query:"limit" validate:"required"`
+	}{})
+	assert.True(t, errors.As(err, &verr))
+	assert.Contains(t, verr.Details(), "limit")
+}
+
+func TestErrorEnvelopeLocalizedMessage(t *testing.T) {
+	srv := errorServer(RateLimitError{RetryAfter: 2 * time.Second})
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	req.Header.Set("Accept-Language", "es-AR, en;q=0.5")
+	res, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer res.Body.Close()
+
+	env := ErrorEnvelope{}
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(&env))
+	assert.Equal(t, ErrorRateLimited, env.Key)
+	assert.Equal(t, "Demasiadas solicitudes, vuelve a intentarlo en 2 segundos", env.LocalizedMessage)
+
+	env = NewErrorEnvelope(NotFound{Err: errors.New(ErrorBookNotFound)}, "")
+	env.Localize(nil, []Locale{Locale("fr"), EnLocale})
+	assert.Equal(t, "Book not found", env.LocalizedMessage)
+}
+
+func TestNotFoundKeepsRemoteKeyOnGet(t *testing.T) {
+	srv := errorServer(NotFound{Err: errors.New(ErrorBookNotFound)})
+	defer srv.Close()
+
+	err := MicroserviceClient{Url: srv.URL}.Get("/", nil, nil)
+	var nf NotFound
+	assert.True(t, errors.As(err, &nf))
+	assert.Equal(t, ErrorResourceNotFound, err.Error())
+
+	var remote RemoteError
+	assert.True(t, errors.As(err, &remote))
+	assert.Equal(t, ErrorBookNotFound, remote.ErrorKey())
+	assert.NotEmpty(t, remote.RequestId)
+
+	_, err = CallGet[struct{}, struct{}](context.Background(), MicroserviceClient{Url: srv.URL}, "/", struct{}{})
+	assert.True(t, errors.As(err, &remote))
+	assert.Equal(t, ErrorBookNotFound, remote.ErrorKey())
+}
+
+func TestEmittedErrorKeysAreTranslated(t *testing.T) {
+	emitted := []error{
+		AccessError{},
+		AccessError{Err: errors.New(ErrorMissingToken)},
+		AccessError{Err: errors.New(ErrorInvalidToken)},
+		AccessError{Err: errors.New(ErrorExpiredToken)},
+		Forbidden{},
+		NotFound{},
+		InvalidRequestError{},
+		PreconditionFailedError{},
+		ConflictError{},
+		NotAcceptableError{},
+		CircuitOpenError{},
+		BulkheadFullError{},
+		IdempotencyConflictError{},
+		RateLimitError{RetryAfter: time.Second},
+		InvalidRequestError{Err: errors.New(ErrorIdempotencyKeyReused)},
+		//Keys of the filter and pagination packages
+		InvalidRequestError{Err: errors.New("invalid-filter")},
+		InvalidRequestError{Err: errors.New("invalid-cursor")},
+	}
+	for _, k := range []string{
+		ErrorFirebaseEmailMissing, ErrorBlockedEmailDomain, ErrorNotExistentTranslation, ErrorPublishedContent,
+		ErrorResourceNotFound, ErrorBookNotFound, ErrorUnmatchedUser, ErrorEmptyArray, ErrorEmptyBook,
+		ErrorAnalyticsPlatformUnsupported, ErrorAnalyticsEventUnsupported, ErrorInvalidObjectId,
+		ErrorSubSubscriptionNotFound, ErrorSubAlreadyExists, ErrorSubOwnedByOtherUser, ErrorUserNotFound,
+		ErrorCMSRightsNeeded, ErrorCMSAdminRightsNeeded, ErrorBookCurrentNotFilled, ErrorIntercomEventUnsupported,
+		ErrorRequiresSubscription, ErrorPublishedContentWithoutDate, ErrorSlugPresent, ErrorConcurrency,
+		ErrorSubscriptionItemPlanNotFound, ErrorValidationFailed, ErrorInvalidParameters,
+	} {
+		emitted = append(emitted, errors.New(k))
+	}
+
+	for _, err := range emitted {
+		env := NewErrorEnvelope(err, "")
+		for _, l := range []Locale{ItLocale, EnLocale, EsLocale} {
+			env.LocalizedMessage = ""
+			env.Localize(err, []Locale{l})
+			assert.NotEmpty(t, env.LocalizedMessage, "%s has no %s translation", env.Key, l)
+		}
+	}
+}
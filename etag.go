@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const (
+	IfNoneMatchCtxKey = "req-if-none-match"
+)
+
+// ETagged responses are sent with an ETag header, and with a 304 when the client already has them
+type ETagged interface {
+	ETag() string
+}
+
+// CachedResponse is an already encoded JSON response
+type CachedResponse struct {
+	Body json.RawMessage
+	Tag  string
+}
+
+func NewCachedResponse(body []byte) CachedResponse {
+	return CachedResponse{
+		Body: body,
+		Tag:  ComputeETag(body),
+	}
+}
+
+func (r CachedResponse) ETag() string {
+	return r.Tag
+}
+
+func (r CachedResponse) MarshalJSON() ([]byte, error) {
+	return r.Body, nil
+}
+
+// ComputeETag returns a strong validator of the body
+func ComputeETag(body []byte) string {
+	h := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(h[:16]) + `"`
+}
+
+// plugIfNoneMatch keeps the header of the safe requests only, a 304 must never hide the outcome of a write
+func plugIfNoneMatch(ctx context.Context, req *http.Request) context.Context {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return ctx
+	}
+	if v := req.Header.Get("If-None-Match"); v != "" {
+		return context.WithValue(ctx, IfNoneMatchCtxKey, v)
+	}
+	return ctx
+}
+
+// writeETag sets the ETag of the response and returns true when the client copy is still valid
+func writeETag(ctx context.Context, w http.ResponseWriter, response interface{}) bool {
+	r, ok := response.(ETagged)
+	if !ok || r.ETag() == "" {
+		return false
+	}
+
+	tag := r.ETag()
+	w.Header().Set("ETag", tag)
+
+	inm, _ := ctx.Value(IfNoneMatchCtxKey).(string)
+	if inm == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(inm, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == strings.TrimPrefix(tag, "W/") {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachedResponseHonoursIfNoneMatch(t *testing.T) {
+	res := NewCachedResponse([]byte(`{"skills":[1,2]}`))
+	e := func(context.Context, interface{}) (interface{}, error) {
+		return res, nil
+	}
+	dec := func(context.Context, *http.Request) (interface{}, error) {
+		return nil, nil
+	}
+	h := NewForwarder(nil).Forward(e, dec)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/skills", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"skills":[1,2]}`, w.Body.String())
+	assert.Equal(t, res.ETag(), w.Header().Get("ETag"))
+
+	req := httptest.NewRequest(http.MethodGet, "/skills", nil)
+	req.Header.Set("If-None-Match", `"stale", `+res.ETag())
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	req = httptest.NewRequest(http.MethodPut, "/skills", nil)
+	req.Header.Set("If-None-Match", "*")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, "writes ignore If-None-Match")
+}
@@ -0,0 +1,172 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+type Op string
+
+const (
+	OpEq      = Op("eq")
+	OpNe      = Op("ne")
+	OpGt      = Op("gt")
+	OpGte     = Op("gte")
+	OpLt      = Op("lt")
+	OpLte     = Op("lte")
+	OpIn      = Op("in")
+	OpNotIn   = Op("nin")
+	OpBetween = Op("between")
+	// OpContains is a case insensitive substring match
+	OpContains = Op("contains")
+	// OpHas matches the rows linked to any of the values, e.g. contents with one of the tags
+	OpHas = Op("has")
+
+	ErrorInvalidFilter = "invalid-filter"
+)
+
+// Condition compares a whitelisted field with its values, the values are kept as strings until compiled
+type Condition struct {
+	Field  string   `json:"field"`
+	Op     Op       `json:"op"`
+	Values []string `json:"values"`
+}
+
+type Sort struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc,omitempty"`
+}
+
+// Expression is the conjunction of its conditions
+type Expression struct {
+	Where []Condition `json:"where,omitempty"`
+	Sort  []Sort      `json:"sort,omitempty"`
+}
+
+type FilterError struct {
+	Field  string
+	Reason string
+}
+
+func (e FilterError) Error() string {
+	return ErrorInvalidFilter + "-" + e.Field
+}
+
+func (e FilterError) Code() int {
+	return http.StatusUnprocessableEntity
+}
+
+func (e FilterError) ErrorKey() string {
+	return ErrorInvalidFilter
+}
+
+func (e FilterError) Details() map[string]string {
+	return map[string]string{e.Field: e.Reason}
+}
+
+// UnmarshalJSON accepts a single "value" besides "values", numbers and booleans are taken as strings
+func (c *Condition) UnmarshalJSON(b []byte) error {
+	raw := struct {
+		Field  string        `json:"field"`
+		Op     Op            `json:"op"`
+		Value  interface{}   `json:"value"`
+		Values []interface{} `json:"values"`
+	}{}
+	//Numbers keep their literal form, float64 would print large ids with an exponent
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+
+	c.Field = raw.Field
+	c.Op = raw.Op
+	if c.Op == "" {
+		c.Op = OpEq
+	}
+	c.Values = make([]string, 0, len(raw.Values)+1)
+	if raw.Value != nil {
+		raw.Values = append([]interface{}{raw.Value}, raw.Values...)
+	}
+	for _, v := range raw.Values {
+		switch t := v.(type) {
+		case string:
+			c.Values = append(c.Values, t)
+		case json.Number:
+			c.Values = append(c.Values, t.String())
+		case bool:
+			c.Values = append(c.Values, fmt.Sprint(t))
+		default:
+			return FilterError{Field: raw.Field, Reason: "values must be scalars"}
+		}
+	}
+
+	return nil
+}
+
+var queryKey = regexp.MustCompile(`^filter\[([a-z0-9_.]+)\](?:\[([a-z]+)\])?$`)
+
+// ParseQuery reads filter[field][op]=v1,v2 and sort=-field1,field2 parameters, the op defaults to eq
+func ParseQuery(q url.Values) (Expression, error) {
+	e := Expression{}
+	for k, vv := range q {
+		m := queryKey.FindStringSubmatch(k)
+		if m == nil {
+			continue
+		}
+
+		op := Op(m[2])
+		if op == "" {
+			op = OpEq
+		}
+		for _, v := range vv {
+			c := Condition{Field: m[1], Op: op}
+			if op.multi() {
+				c.Values = strings.Split(v, ",")
+			} else {
+				c.Values = []string{v}
+			}
+			e.Where = append(e.Where, c)
+		}
+	}
+
+	if s := q.Get("sort"); s != "" {
+		for _, f := range strings.Split(s, ",") {
+			f = strings.TrimSpace(f)
+			if f == "" {
+				continue
+			}
+			desc := strings.HasPrefix(f, "-")
+			e.Sort = append(e.Sort, Sort{Field: strings.TrimPrefix(f, "-"), Desc: desc})
+		}
+	}
+
+	//Map iteration is random, the compiled query must not be
+	sortConditions(e.Where)
+
+	return e, nil
+}
+
+// ParseJSON decodes an expression sent in a request body or in a single query parameter
+func ParseJSON(b []byte) (Expression, error) {
+	e := Expression{}
+	if err := json.Unmarshal(b, &e); err != nil {
+		var fe FilterError
+		if errors.As(err, &fe) {
+			return e, fe
+		}
+		return e, FilterError{Field: "filter", Reason: "malformed json"}
+	}
+
+	return e, nil
+}
+
+func (o Op) multi() bool {
+	return o == OpIn || o == OpNotIn || o == OpBetween || o == OpHas
+}
@@ -0,0 +1,56 @@
+package filter
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type cont struct {
+	Id    uint32
+	Title string
+}
+
+var contSchema = Schema{
+	"title":        {Column: "title", Sortable: true},
+	"published_at": {Column: "published_at", Type: TypeDate, Sortable: true},
+	"tag":          {Membership: "SELECT cont_id FROM cont_tags WHERE tag_id IN ?", MembershipKey: "id", Type: TypeInt},
+}
+
+func TestExpressionScope(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	assert.Nil(t, err)
+
+	q, _ := url.ParseQuery("filter[title][contains]=10%25&filter[published_at][between]=2021-01-01,2021-12-31&filter[tag][has]=1,2&sort=-published_at,title")
+	e, err := ParseQuery(q)
+	assert.Nil(t, err)
+
+	scope, err := e.Scope(contSchema)
+	assert.Nil(t, err)
+	stmt := db.Model(&cont{}).Scopes(scope).Find(&[]cont{}).Statement
+	assert.Equal(t, `SELECT * FROM "conts" WHERE ("published_at" BETWEEN $1 AND $2) AND "id" IN (SELECT cont_id FROM cont_tags WHERE tag_id IN ($3,$4)) AND "title" ILIKE $5 ORDER BY "published_at" DESC,"title" ASC`, stmt.SQL.String())
+	assert.Equal(t, `%10\%%`, stmt.Vars[4])
+
+	e, err = ParseJSON([]byte(`{"where":[{"field":"tag","op":"has","values":["x"]}]}`))
+	assert.Nil(t, err)
+	assert.Equal(t, FilterError{Field: "tag", Reason: "not an integer"}, e.Validate(contSchema))
+
+	e, _ = ParseJSON([]byte(`{"where":[{"field":"password","value":"x"}]}`))
+	assert.NotNil(t, e.Validate(contSchema))
+	e, _ = ParseJSON([]byte(`{"where":[{"field":"title","op":"gt","value":"x"}]}`))
+	assert.NotNil(t, e.Validate(contSchema))
+
+	s := Schema{"year": {Column: "year", Type: TypeInt, Ops: []Op{OpContains}}}
+	e, _ = ParseJSON([]byte(`{"where":[{"field":"year","op":"contains","value":"2021"}]}`))
+	assert.Equal(t, FilterError{Field: "year", Reason: "not a text field"}, e.Validate(s))
+}
+
+func TestConditionKeepsNumberLiterals(t *testing.T) {
+	c := Condition{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"field":"id","op":"in","value":1234567,"values":[1.5,true,"x"]}`), &c))
+	assert.Equal(t, []string{"1234567", "1.5", "true", "x"}, c.Values)
+}
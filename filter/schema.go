@@ -0,0 +1,260 @@
+package filter
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/4books-sparta/utils/models"
+)
+
+type FieldType int
+
+const (
+	TypeString FieldType = iota
+	TypeInt
+	TypeBool
+	// TypeDate accepts days and RFC 3339 timestamps
+	TypeDate
+)
+
+const (
+	// MaxValues bounds the values of a single condition
+	MaxValues = 100
+)
+
+// Field is a filterable field of an endpoint
+type Field struct {
+	Column string
+	Type   FieldType
+	// Ops are the allowed operators, by default the ones making sense for the type
+	Ops []Op
+	// Membership is the subquery selecting the ids linked to the values for OpHas,
+	// e.g. "SELECT cont_id FROM cont_tags WHERE tag_id IN ?", matched against MembershipKey
+	Membership    string
+	MembershipKey string
+	Sortable      bool
+}
+
+// Schema is the whitelist of the fields of an endpoint, keyed by their public name
+type Schema map[string]Field
+
+func (f Field) allows(op Op) bool {
+	ops := f.Ops
+	if len(ops) == 0 {
+		ops = defaultOps(f)
+	}
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+
+	return false
+}
+
+func defaultOps(f Field) []Op {
+	if f.Membership != "" {
+		return []Op{OpHas}
+	}
+
+	switch f.Type {
+	case TypeInt, TypeDate:
+		return []Op{OpEq, OpNe, OpGt, OpGte, OpLt, OpLte, OpIn, OpNotIn, OpBetween}
+	case TypeBool:
+		return []Op{OpEq, OpNe}
+	}
+
+	return []Op{OpEq, OpNe, OpIn, OpNotIn, OpContains}
+}
+
+func (f Field) convert(name string, v string) (interface{}, error) {
+	switch f.Type {
+	case TypeInt:
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, FilterError{Field: name, Reason: "not an integer"}
+		}
+		return i, nil
+	case TypeBool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, FilterError{Field: name, Reason: "not a boolean"}
+		}
+		return b, nil
+	case TypeDate:
+		if t, err := time.Parse(models.DayHourLayout, v); err == nil {
+			return t, nil
+		}
+		t, err := time.Parse(models.DayLayout, v)
+		if err != nil {
+			return nil, FilterError{Field: name, Reason: "not a date"}
+		}
+		return t, nil
+	}
+
+	return v, nil
+}
+
+// Validate checks the expression against the whitelist
+func (e Expression) Validate(s Schema) error {
+	_, err := e.compile(s)
+	return err
+}
+
+// Scope validates the expression and compiles it to a GORM scope
+func (e Expression) Scope(s Schema) (func(*gorm.DB) *gorm.DB, error) {
+	c, err := e.compile(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		for _, w := range c.where {
+			db = db.Where(w.sql(db), w.args...)
+		}
+		for _, o := range c.order {
+			db = db.Order(db.Statement.Quote(o.column) + o.dir)
+		}
+		return db
+	}, nil
+}
+
+type compiled struct {
+	where []clause
+	order []orderBy
+}
+
+type clause struct {
+	column string
+	tmpl   string
+	args   []interface{}
+}
+
+// sql quotes the column, the template never contains request input
+func (c clause) sql(db *gorm.DB) string {
+	return strings.ReplaceAll(c.tmpl, "{col}", db.Statement.Quote(c.column))
+}
+
+type orderBy struct {
+	column string
+	dir    string
+}
+
+func (e Expression) compile(s Schema) (compiled, error) {
+	ret := compiled{}
+
+	for _, c := range e.Where {
+		f, ok := s[c.Field]
+		if !ok {
+			return ret, FilterError{Field: c.Field, Reason: "not filterable"}
+		}
+		if !f.allows(c.Op) {
+			return ret, FilterError{Field: c.Field, Reason: "operator " + string(c.Op) + " not allowed"}
+		}
+		if len(c.Values) == 0 || len(c.Values) > MaxValues {
+			return ret, FilterError{Field: c.Field, Reason: "wrong number of values"}
+		}
+
+		vals := make([]interface{}, 0, len(c.Values))
+		for _, v := range c.Values {
+			cv, err := f.convert(c.Field, strings.TrimSpace(v))
+			if err != nil {
+				return ret, err
+			}
+			vals = append(vals, cv)
+		}
+
+		cl, err := condition(c, f, vals)
+		if err != nil {
+			return ret, err
+		}
+		ret.where = append(ret.where, cl)
+	}
+
+	for _, o := range e.Sort {
+		f, ok := s[o.Field]
+		if !ok || !f.Sortable {
+			return ret, FilterError{Field: o.Field, Reason: "not sortable"}
+		}
+		dir := " ASC"
+		if o.Desc {
+			dir = " DESC"
+		}
+		ret.order = append(ret.order, orderBy{column: f.Column, dir: dir})
+	}
+
+	return ret, nil
+}
+
+var comparisons = map[Op]string{
+	OpEq:  "=",
+	OpNe:  "<>",
+	OpGt:  ">",
+	OpGte: ">=",
+	OpLt:  "<",
+	OpLte: "<=",
+}
+
+func condition(c Condition, f Field, vals []interface{}) (clause, error) {
+	cl := clause{column: f.Column}
+
+	if cmp, ok := comparisons[c.Op]; ok {
+		if len(vals) != 1 {
+			return cl, FilterError{Field: c.Field, Reason: "one value expected"}
+		}
+		cl.tmpl = "{col} " + cmp + " ?"
+		cl.args = vals
+		return cl, nil
+	}
+
+	switch c.Op {
+	case OpIn:
+		cl.tmpl = "{col} IN ?"
+		cl.args = []interface{}{vals}
+	case OpNotIn:
+		cl.tmpl = "{col} NOT IN ?"
+		cl.args = []interface{}{vals}
+	case OpBetween:
+		if len(vals) != 2 {
+			return cl, FilterError{Field: c.Field, Reason: "two values expected"}
+		}
+		cl.tmpl = "{col} BETWEEN ? AND ?"
+		cl.args = vals
+	case OpContains:
+		if len(vals) != 1 {
+			return cl, FilterError{Field: c.Field, Reason: "one value expected"}
+		}
+		//Ops may allow it on any type, ILIKE only works on text
+		s, ok := vals[0].(string)
+		if !ok {
+			return cl, FilterError{Field: c.Field, Reason: "not a text field"}
+		}
+		cl.tmpl = "{col} ILIKE ?"
+		cl.args = []interface{}{"%" + escapeLike(s) + "%"}
+	case OpHas:
+		cl.column = f.MembershipKey
+		cl.tmpl = "{col} IN (" + f.Membership + ")"
+		cl.args = []interface{}{vals}
+	default:
+		return cl, FilterError{Field: c.Field, Reason: "unknown operator " + string(c.Op)}
+	}
+
+	return cl, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func sortConditions(cc []Condition) {
+	sort.SliceStable(cc, func(i, j int) bool {
+		if cc[i].Field != cc[j].Field {
+			return cc[i].Field < cc[j].Field
+		}
+		return cc[i].Op < cc[j].Op
+	})
+}
@@ -2,10 +2,13 @@ package utils
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"github.com/4books-sparta/utils/cache"
+	"github.com/4books-sparta/utils/correlation"
+	"github.com/4books-sparta/utils/tracing"
 	"github.com/google/uuid"
 	"io"
 	"net/http"
@@ -27,7 +30,11 @@ const (
 )
 
 type Forwarder struct {
-	auth            Authorizer      `json:"auth,omitempty"`
+	auth            Authorizer `json:"auth,omitempty"`
+	cors            *CORSPolicy
+	rateLimit       *RateLimitPolicy
+	idempotency     *IdempotencyPolicy
+	locale          *LocalePolicy
 	ApiResponseType ApiResponseType `json:"response_type,omitempty"`
 }
 
@@ -57,36 +64,93 @@ func NewForwarderWithResponseType(af Authorizer, rt ApiResponseType) *Forwarder
 func (f *Forwarder) forward(e endpoint.Endpoint, dec kitHttp.DecodeRequestFunc, opts ...kitHttp.ServerOption) *kitHttp.Server {
 	mid := []kitHttp.ServerOption{
 		kitHttp.ServerErrorEncoder(errorEncoder),
+		kitHttp.ServerBefore(kitHttp.PopulateRequestContext),
+		kitHttp.ServerBefore(correlation.ServerBefore),
+		kitHttp.ServerBefore(tracing.ServerBefore),
+		kitHttp.ServerBefore(f.plugCORS),
 		kitHttp.ServerBefore(blockWrongSlug),
 		kitHttp.ServerBefore(plugRefresh),
+		kitHttp.ServerBefore(plugIfNoneMatch),
+		kitHttp.ServerBefore(f.plugLocale),
 		kitHttp.ServerAfter(writeCORS),
+		kitHttp.ServerAfter(correlation.ServerAfter),
 	}
 	mid = append(mid, opts...)
 
+	if f.idempotent() {
+		//Forward and SecureForward wrap the endpoint inside the authorization
+		mid = append(mid, kitHttp.ServerBefore(f.plugIdempotencyKey))
+	}
+	if f.rateLimit != nil {
+		//Wrapping the secured endpoint, the authorization is already in the context
+		e = f.rateLimit.Wrap(e)
+		mid = append(mid, kitHttp.ServerBefore(f.plugRateLimit))
+	}
+
+	var enc kitHttp.EncodeResponseFunc
 	switch f.ApiResponseType {
-	case ApiResponseTypeJson:
-		return kitHttp.NewServer(e, dec, encodeResponse, mid...)
 	case ApiResponseTypeTempRedirect:
-		return kitHttp.NewServer(e, dec, tempRedirectEncodedResponse, mid...)
+		enc = tempRedirectEncodedResponse
 	case ApiResponseTypePermanentRedirect:
-		return kitHttp.NewServer(e, dec, permanentRedirectEncodedResponse, mid...)
+		enc = permanentRedirectEncodedResponse
 	case ApiResponseTypeCsv:
-		return kitHttp.NewServer(e, dec, csvEncodedResponse, mid...)
+		enc = csvEncodedResponse
 	case ApiResponseTypeXml:
-		return kitHttp.NewServer(e, dec, xmlEncodedResponse, mid...)
+		enc = xmlEncodedResponse
 	case ApiResponseTypeFile:
-		return kitHttp.NewServer(e, dec, fileEncodedResponse, mid...)
+		enc = fileEncodedResponse
+	case ApiResponseTypeNdjson:
+		enc = ndjsonEncodedResponse
+	case ApiResponseTypeNegotiated:
+		enc = negotiatedEncodedResponse
+	default:
+		enc = encodeResponse
 	}
 
-	return kitHttp.NewServer(e, dec, encodeResponse, mid...)
+	return kitHttp.NewServer(e, dec, endServerSpan(enc), mid...)
+}
+
+// endServerSpan ends the span started by tracing.ServerBefore once the response is written, errorEncoder ends the failed ones.
+// A go-kit finalizer would hide the http.Flusher of the writer from the streams
+func endServerSpan(enc kitHttp.EncodeResponseFunc) kitHttp.EncodeResponseFunc {
+	return func(ctx context.Context, w http.ResponseWriter, response interface{}) (err error) {
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		defer func() {
+			//Also run when a broken stream aborts the handler
+			if err == nil {
+				tracing.ServerFinalizer(ctx, sw.code, nil)
+			}
+		}()
+
+		return enc(ctx, sw, response)
+	}
+}
+
+// statusWriter keeps the status of the response for the server span
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Flush() {
+	flush(w.ResponseWriter)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
 }
 
 func (f *Forwarder) Forward(e endpoint.Endpoint, dec kitHttp.DecodeRequestFunc) *kitHttp.Server {
-	return f.forward(e, dec)
+	return f.forward(f.idempotentEndpoint(e), dec)
 }
 
 func (f *Forwarder) SecureForward(e endpoint.Endpoint, dec kitHttp.DecodeRequestFunc) *kitHttp.Server {
-	return f.forward(secureWrap(e, true), dec, kitHttp.ServerBefore(f.plugAuth))
+	return f.forward(secureWrap(f.idempotentEndpoint(e), true), dec, kitHttp.ServerBefore(f.plugAuth))
 }
 
 func plugRefresh(ctx context.Context, req *http.Request) context.Context {
@@ -108,29 +172,39 @@ func blockWrongSlug(ctx context.Context, req *http.Request) context.Context {
 	return ctx
 }
 
-func errorEncoder(_ context.Context, err error, w http.ResponseWriter) {
-	setCORS(w)
+func errorEncoder(ctx context.Context, err error, w http.ResponseWriter) {
+	setCORS(ctx, w)
+	correlation.ServerAfter(ctx, w)
+	tracing.RecordError(ctx, err)
+	if h, ok := err.(kitHttp.Headerer); ok {
+		for k, vv := range h.Headers() {
+			for _, v := range vv {
+				w.Header().Add(k, v)
+			}
+		}
+	}
 	w.Header().Set("Content-Type", "application/json")
 
-	c, ok := err.(WithCode)
-	if ok {
-		w.WriteHeader(c.Code())
-	} else {
-		w.WriteHeader(400)
-	}
+	body := NewErrorEnvelope(err, correlation.FromContext(ctx))
+	body.Localize(err, LocaleChainFromContext(ctx))
 
-	body := map[string]string{
-		"message": err.Error(),
-	}
+	w.WriteHeader(body.Code)
 	_ = json.NewEncoder(w).Encode(body)
+	tracing.ServerFinalizer(ctx, body.Code, nil)
 }
 
-func encodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	if v, ok := response.(RedirectResponse); ok {
 		w.Header().Set("Location", v.RedirectTo())
 		w.WriteHeader(http.StatusTemporaryRedirect)
 		return nil
 	}
+	if s, ok := response.(StreamResponse); ok {
+		return encodeStream(w, s, streamJson)
+	}
+	if writeETag(ctx, w, response) {
+		return nil
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	return json.NewEncoder(w).Encode(response)
@@ -179,6 +253,10 @@ func fileEncodedResponse(_ context.Context, w http.ResponseWriter, response inte
 }
 
 func xmlEncodedResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	if s, ok := response.(StreamResponse); ok {
+		return encodeStream(w, s, streamXml)
+	}
+
 	dl, ok := response.(DownloadFile)
 	if !ok {
 		return errors.New("response is not of type DownloadFile")
@@ -195,6 +273,10 @@ func xmlEncodedResponse(_ context.Context, w http.ResponseWriter, response inter
 }
 
 func csvEncodedResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	if s, ok := response.(StreamResponse); ok {
+		return encodeStream(w, s, streamCsv)
+	}
+
 	rows, ok := response.([][]string)
 	if !ok {
 		return errors.New("response is not a [][]string")
@@ -212,24 +294,6 @@ func csvEncodedResponse(_ context.Context, w http.ResponseWriter, response inter
 	return nil
 }
 
-func writeCORS(ctx context.Context, w http.ResponseWriter) context.Context {
-	setCORS(w)
-
-	return ctx
-}
-
-func Preflight(w http.ResponseWriter, _ *http.Request) {
-	setCORS(w)
-	w.WriteHeader(200)
-}
-
-func setCORS(w http.ResponseWriter) {
-	h := w.Header()
-	h.Set("Access-Control-Allow-Origin", "*")
-	h.Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS, PATCH")
-	h.Set("Access-Control-Allow-Headers", "Content-Type, Accept-Language, Authorization, X-Cms-Version, x-client-type, x-client-version")
-}
-
 type RedirectResponse interface {
 	RedirectTo() string
 }
@@ -255,9 +319,9 @@ func secureWrap(actual endpoint.Endpoint, required bool) endpoint.Endpoint {
 }
 
 func authenticated(ctx context.Context, strict bool) (*Authorization, error) {
-	auth, ok := ctx.Value(AuthCtxKey).(Authorization)
+	auth, ok := AuthorizationFromContext(ctx)
 	if strict && (!ok || auth.Error != nil) {
-		return nil, AccessError{}
+		return nil, AccessError{Err: auth.Error}
 	}
 
 	return &auth, nil
@@ -279,6 +343,10 @@ func (e AccessError) Code() int {
 	return 401
 }
 
+func (e AccessError) Unwrap() error {
+	return e.Err
+}
+
 const (
 	AuthTokenHeaderName = "x-auth-token"
 )
@@ -288,5 +356,5 @@ func ExtractApiToken(req *http.Request) string {
 }
 
 func IsApiTokenCorrect(req *http.Request, shouldBe string) bool {
-	return ExtractApiToken(req) == shouldBe
+	return subtle.ConstantTimeCompare([]byte(ExtractApiToken(req)), []byte(shouldBe)) == 1
 }
@@ -13,6 +13,8 @@ import (
 
 	"cloud.google.com/go/pubsub"
 	"google.golang.org/api/iterator"
+
+	"github.com/4books-sparta/utils/correlation"
 )
 
 const (
@@ -143,7 +145,7 @@ func (c *Client) HandleMessages(ctx context.Context, name string, handle func(co
 	sub := c.client.Subscription(name)
 	err := sub.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
 		mu.Lock()
-		failErr := handle(ctx, msg)
+		failErr := handle(correlation.FromAttributes(ctx, msg.Attributes), msg)
 		if failErr != nil {
 			c.ErrorLog("cant-handle-message"+msg.ID, failErr)
 			msg.Nack()
@@ -160,6 +162,16 @@ func (c *Client) HandleMessages(ctx context.Context, name string, handle func(co
 	return nil
 }
 
+// PingContext checks that the Pub/Sub API answers by reading the first topic of the project
+func (c *Client) PingContext(ctx context.Context) error {
+	_, err := c.client.Topics(ctx).Next()
+	if errors.Is(err, iterator.Done) {
+		return nil
+	}
+
+	return err
+}
+
 func (c *Client) ListTopics(ctx context.Context) ([]*pubsub.Topic, error) {
 	var topics []*pubsub.Topic
 	it := c.client.Topics(ctx)
@@ -183,7 +195,8 @@ func (c *Client) ListTopics(ctx context.Context) ([]*pubsub.Topic, error) {
 
 func (c *Client) Publish(ctx context.Context, t *pubsub.Topic, msg string, key string) error {
 	message := pubsub.Message{
-		Data: []byte(msg),
+		Data:       []byte(msg),
+		Attributes: correlation.Attributes(ctx),
 	}
 	if key != "" {
 		message.OrderingKey = key
@@ -245,8 +258,15 @@ func (c *Client) PanicHandler(todo func(args any)) {
 }
 
 func (c *Client) Consume(ctx context.Context, sub *pubsub.Subscription, handler func(msg []byte) error) error {
+	return c.ConsumeCtx(ctx, sub, func(_ context.Context, msg []byte) error {
+		return handler(msg)
+	})
+}
+
+// ConsumeCtx passes to the handler a context holding the request id of the publisher
+func (c *Client) ConsumeCtx(ctx context.Context, sub *pubsub.Subscription, handler func(ctx context.Context, msg []byte) error) error {
 	return sub.Receive(ctx, func(ctx context.Context, message *pubsub.Message) {
-		if handleErr := handler(message.Data); handleErr != nil {
+		if handleErr := handler(correlation.FromAttributes(ctx, message.Attributes), message.Data); handleErr != nil {
 			c.Log(ErrorLevel, "NACK "+handleErr.Error()+string(message.Data))
 			fmt.Println("NACK ", handleErr.Error(), string(message.Data))
 			message.Nack()
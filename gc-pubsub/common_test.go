@@ -0,0 +1,53 @@
+package gc_pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/4books-sparta/utils/correlation"
+)
+
+func TestRequestIdIsPropagatedThroughAttributes(t *testing.T) {
+	srv := pstest.NewServer()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cl, err := pubsub.NewClient(ctx, "project",
+		option.WithEndpoint(srv.Addr),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer cl.Close()
+	c := &Client{client: cl}
+
+	topic, err := c.CreateTopic(ctx, "books")
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Nil(t, c.CreateSubscription(ctx, "books-sub", pubsub.SubscriptionConfig{Topic: topic}))
+	assert.Nil(t, c.PublishToTopicID(correlation.WithRequestID(ctx, "abc-123"), "books", "{}", ""))
+	c.StopActiveTopics()
+
+	var got string
+	recvCtx, stop := context.WithCancel(ctx)
+	err = c.ConsumeCtx(recvCtx, c.Subscribe("books-sub"), func(ctx context.Context, msg []byte) error {
+		got = correlation.FromContext(ctx)
+		stop()
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "abc-123", got)
+}
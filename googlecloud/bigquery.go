@@ -7,6 +7,10 @@ import (
 	"fmt"
 
 	"cloud.google.com/go/bigquery"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/4books-sparta/utils/tracing"
 )
 
 const BigQueryErrPrefix = "Google-Bigquery-"
@@ -57,7 +61,22 @@ func (cl *BigqueryClient) Exec(ctx context.Context, sql string) (*bigquery.RowIt
 	if cl.client == nil {
 		return nil, errors.New("bigquery-client-nil")
 	}
-	return cl.client.Query(sql).Read(ctx)
+	attrs := append([]attribute.KeyValue{attribute.String("db.system", "bigquery")}, tracing.QueryText(sql)...)
+	ctx, span := tracing.Start(ctx, "bigquery query", trace.SpanKindClient, attrs...)
+	it, err := cl.client.Query(sql).Read(ctx)
+	tracing.End(span, err)
+
+	return it, err
+}
+
+// PingContext checks that the configured dataset is reachable
+func (cl *BigqueryClient) PingContext(ctx context.Context) error {
+	if cl.client == nil {
+		return errors.New("bigquery-client-nil")
+	}
+
+	_, err := cl.client.Dataset(cl.config.Dataset).Metadata(ctx)
+	return err
 }
 
 func (cl *BigqueryClient) Log(title string, args []string) {
@@ -71,6 +90,10 @@ func (cl *BigqueryClient) Log(title string, args []string) {
 }
 
 func (cl *BigqueryClient) SaveRecords(table string, payload []*BigQuerySavePayload) error {
+	return cl.SaveRecordsCtx(context.Background(), table, payload)
+}
+
+func (cl *BigqueryClient) SaveRecordsCtx(ctx context.Context, table string, payload []*BigQuerySavePayload) error {
 	if cl.client == nil {
 		cl.Log("SaveRecords", []string{"bigquery-client-nil"})
 		return errors.New("bigquery-client-nil")
@@ -78,8 +101,15 @@ func (cl *BigqueryClient) SaveRecords(table string, payload []*BigQuerySavePaylo
 
 	dataset := cl.config.Dataset
 	cl.Log("SaveRecords", []string{dataset, table})
+	ctx, span := tracing.Start(ctx, "bigquery insert "+table, trace.SpanKindClient,
+		attribute.String("db.system", "bigquery"),
+		attribute.String("db.namespace", dataset),
+		attribute.String("db.collection.name", table),
+		attribute.Int("db.operation.batch.size", len(payload)),
+	)
 	ins := cl.client.Dataset(dataset).Table(table).Inserter()
-	err := ins.Put(context.Background(), payload)
+	err := ins.Put(ctx, payload)
+	tracing.End(span, err)
 	if err != nil {
 		if multiError, ok := err.(bigquery.PutMultiError); ok {
 			for _, err1 := range multiError {
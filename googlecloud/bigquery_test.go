@@ -0,0 +1,56 @@
+package googlecloud
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/api/option"
+
+	"github.com/4books-sparta/utils/tracing"
+)
+
+func TestBigquerySpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracing.Enable(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)), nil)
+	defer tracing.Disable()
+
+	//Every call is rejected, the spans must record the failures
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"code":400,"message":"invalid"}}`))
+	}))
+	defer srv.Close()
+
+	bq, err := bigquery.NewClient(context.Background(), "project", option.WithEndpoint(srv.URL), option.WithoutAuthentication())
+	assert.Nil(t, err)
+	cl := &BigqueryClient{client: bq, config: &BigQueryConfig{ProjectId: "project", Dataset: "events"}}
+
+	_, err = cl.Exec(context.Background(), "SELECT secret FROM users")
+	assert.NotNil(t, err)
+	err = cl.SaveRecordsCtx(context.Background(), "reads", []*BigQuerySavePayload{{Item: map[string]bigquery.Value{"id": 1}}})
+	assert.NotNil(t, err)
+
+	spans := exporter.GetSpans()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+	assert.Equal(t, "bigquery query", spans[0].Name)
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	for _, a := range spans[0].Attributes {
+		assert.NotEqual(t, tracing.AttributeQueryText, a.Key, "the query text is opt-in")
+	}
+
+	assert.Equal(t, "bigquery insert reads", spans[1].Name)
+	assert.Equal(t, codes.Error, spans[1].Status.Code)
+	assert.Contains(t, spans[1].Attributes, attribute.String("db.collection.name", "reads"))
+	assert.Contains(t, spans[1].Attributes, attribute.Int("db.operation.batch.size", 1))
+}
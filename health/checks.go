@@ -0,0 +1,43 @@
+package health
+
+import (
+	"context"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/4books-sparta/utils"
+	"github.com/4books-sparta/utils/cache"
+	gcpubsub "github.com/4books-sparta/utils/gc-pubsub"
+	"github.com/4books-sparta/utils/googlecloud"
+	"github.com/4books-sparta/utils/kafka2"
+)
+
+func SqlDatabaseCheck(db *utils.SqlDatabase) Check {
+	return db.PingContext
+}
+
+func RedisCheck(c redis.UniversalClient) Check {
+	return func(ctx context.Context) error {
+		if c == nil {
+			return errors.New(cache.RedisNotAvailableError)
+		}
+		return c.Ping(ctx).Err()
+	}
+}
+
+func KafkaProducerCheck(p *kafka2.KafkaProducer) Check {
+	return p.PingContext
+}
+
+func KafkaConsumerCheck(c *kafka2.KafkaConsumer) Check {
+	return c.PingContext
+}
+
+func PubSubCheck(c *gcpubsub.Client) Check {
+	return c.PingContext
+}
+
+func BigqueryCheck(cl *googlecloud.BigqueryClient) Check {
+	return cl.PingContext
+}
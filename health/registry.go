@@ -0,0 +1,166 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/4books-sparta/utils"
+	"github.com/4books-sparta/utils/instruments"
+)
+
+const (
+	DefaultTimeout = 2 * time.Second
+)
+
+// Check returns an error when the dependency is not usable
+type Check func(ctx context.Context) error
+
+type registration struct {
+	check    Check
+	timeout  time.Duration
+	critical bool
+}
+
+type CheckOption func(*registration)
+
+func Timeout(d time.Duration) CheckOption {
+	return func(r *registration) {
+		r.timeout = d
+	}
+}
+
+// NonCritical checks are reported without setting the overall status down
+func NonCritical() CheckOption {
+	return func(r *registration) {
+		r.critical = false
+	}
+}
+
+type HealthRegistry struct {
+	mu     sync.RWMutex
+	checks map[string]registration
+	met    *instruments.HealthMetric
+}
+
+// NewHealthRegistry creates an empty registry, met may be nil
+func NewHealthRegistry(met *instruments.HealthMetric) *HealthRegistry {
+	return &HealthRegistry{
+		checks: make(map[string]registration),
+		met:    met,
+	}
+}
+
+// Register adds a critical check with DefaultTimeout, a check with the same name is replaced
+func (h *HealthRegistry) Register(name string, c Check, opts ...CheckOption) {
+	r := registration{
+		check:    c,
+		timeout:  DefaultTimeout,
+		critical: true,
+	}
+	for _, o := range opts {
+		o(&r)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.checks[name] = r
+}
+
+func (h *HealthRegistry) Names() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ret := make([]string, 0, len(h.checks))
+	for k := range h.checks {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+
+	return ret
+}
+
+// Probe runs all the checks concurrently
+func (h *HealthRegistry) Probe(ctx context.Context) utils.ProbeResponse {
+	h.mu.RLock()
+	checks := make(map[string]registration, len(h.checks))
+	for k, r := range h.checks {
+		checks[k] = r
+	}
+	h.mu.RUnlock()
+
+	res := utils.ProbeResponse{
+		Status: utils.ProbeStatusUp,
+		Checks: make(map[string]utils.ProbeCheck, len(checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, r := range checks {
+		wg.Add(1)
+		go func(name string, r registration) {
+			defer wg.Done()
+
+			pc := run(ctx, r)
+			h.observe(name, pc)
+
+			mu.Lock()
+			defer mu.Unlock()
+			res.Checks[name] = pc
+			if pc.Critical && pc.Status == utils.ProbeStatusDown {
+				res.Status = utils.ProbeStatusDown
+			}
+		}(name, r)
+	}
+	wg.Wait()
+
+	return res
+}
+
+func run(ctx context.Context, r registration) utils.ProbeCheck {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	begin := time.Now()
+	err := r.check(ctx)
+	pc := utils.ProbeCheck{
+		Status:    utils.ProbeStatusUp,
+		Critical:  r.critical,
+		LatencyMs: float64(time.Since(begin).Microseconds()) / 1000,
+	}
+	if err != nil {
+		pc.Status = utils.ProbeStatusDown
+		pc.Error = err.Error()
+	}
+
+	return pc
+}
+
+func (h *HealthRegistry) observe(name string, pc utils.ProbeCheck) {
+	if h.met == nil {
+		return
+	}
+
+	h.met.Status.With("check", name, "critical", strconv.FormatBool(pc.Critical)).Set(float64(pc.Status))
+	h.met.Latency.With("check", name).Set(pc.LatencyMs / 1000)
+}
+
+// Handler serves the probe as JSON, with a 503 when a critical check fails
+func (h *HealthRegistry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteProbe(w, h.Probe(r.Context()))
+	})
+}
+
+func WriteProbe(w http.ResponseWriter, res utils.ProbeResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if res.Status != utils.ProbeStatusUp {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(res)
+}
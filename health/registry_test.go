@@ -0,0 +1,42 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/4books-sparta/utils"
+	"github.com/4books-sparta/utils/instruments"
+)
+
+func TestRegistryCriticality(t *testing.T) {
+	h := NewHealthRegistry(instruments.DummyHealthMetric("test"))
+	h.Register("db", func(context.Context) error {
+		return nil
+	})
+	h.Register("bigquery", func(context.Context) error {
+		return errors.New("unreachable")
+	}, NonCritical())
+
+	res := h.Probe(context.Background())
+	assert.Equal(t, utils.ProbeStatusUp, res.Status)
+	assert.Equal(t, utils.ProbeStatusDown, res.Checks["bigquery"].Status)
+	assert.False(t, res.Checks["bigquery"].Critical)
+	assert.Equal(t, []string{"bigquery", "db"}, h.Names())
+
+	h.Register("redis", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, Timeout(10*time.Millisecond))
+
+	w := httptest.NewRecorder()
+	h.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), `"redis":{"status":0,"critical":true`)
+	assert.Contains(t, w.Body.String(), context.DeadlineExceeded.Error())
+}
@@ -2,11 +2,17 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"time"
+
+	"github.com/4books-sparta/utils/correlation"
+	"github.com/4books-sparta/utils/tracing"
 )
 
 type MicroserviceClient struct {
@@ -17,141 +23,165 @@ type MicroserviceClient struct {
 	PermanentUrlParams url.Values
 	GetUrl             func(path string) string
 	ErrorParser        func(res *http.Response) error
+	// HttpClient is shared between calls, when nil DefaultMicroserviceHttpClient is used
+	HttpClient *http.Client
+	// Retry is the retry policy applied to every call, when nil requests are sent only once
+	Retry *RetryPolicy
+	// Breakers opens a circuit per target host when it keeps failing or answering slowly
+	Breakers *CircuitBreakers
+	// Bulkhead limits the concurrent calls made through this client
+	Bulkhead *Bulkhead
 }
 
-func (msc MicroserviceClient) Post(path string, payload interface{}, ret interface{}) error {
-	u := msc.getUrl(path)
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return err
-	}
+type HttpTransportConfig struct {
+	DialTimeout           time.Duration
+	KeepAlive             time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	MaxIdleConns          int
+	MaxIdleConnsPerHost   int
+	MaxConnsPerHost       int
+}
 
-	request, err := http.NewRequest("POST", u, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return err
+func DefaultHttpTransportConfig() HttpTransportConfig {
+	return HttpTransportConfig{
+		DialTimeout:         5 * time.Second,
+		KeepAlive:           30 * time.Second,
+		TLSHandshakeTimeout: 5 * time.Second,
+		IdleConnTimeout:     90 * time.Second,
+		MaxIdleConns:        200,
+		MaxIdleConnsPerHost: 20,
 	}
+}
 
-	if msc.PermanentUrlParams != nil && len(msc.PermanentUrlParams) > 0 {
-		request.URL.RawQuery = msc.PermanentUrlParams.Encode()
+func NewHttpTransport(cfg HttpTransportConfig) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: cfg.KeepAlive,
 	}
 
-	request.Header.Set("Content-Type", "application/json; charset=UTF-8")
-	msc.fillPermanentHeaders(request)
-
-	client := &http.Client{}
-	if msc.TimeOut > 0 {
-		client.Timeout = msc.TimeOut
-	}
-	response, err := client.Do(request)
-	if err != nil {
-		return err
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
 	}
-	defer func() {
-		_ = response.Body.Close()
-	}()
+}
 
-	if response.StatusCode != http.StatusOK {
-		if msc.ErrorParser != nil {
-			return msc.ErrorParser(response)
-		}
-		return ServiceResponse2Error(response)
+func NewHttpClient(cfg HttpTransportConfig) *http.Client {
+	return &http.Client{
+		Transport: NewHttpTransport(cfg),
 	}
+}
 
-	if ret == nil {
-		//Nothing to parse
-		return nil
-	}
+// DefaultMicroserviceHttpClient is used by every MicroserviceClient without its own HttpClient,
+// so that connections to sibling services are pooled instead of being opened on each call
+var DefaultMicroserviceHttpClient = NewHttpClient(DefaultHttpTransportConfig())
 
-	err = DecodeResponseBody(response, ret)
-	if err != nil {
-		return err
-	}
+func (msc MicroserviceClient) Post(path string, payload interface{}, ret interface{}) error {
+	return msc.PostCtx(context.Background(), path, payload, ret)
+}
 
-	return nil
+func (msc MicroserviceClient) PostCtx(ctx context.Context, path string, payload interface{}, ret interface{}) error {
+	return msc.sendPayload(ctx, http.MethodPost, path, payload, ret)
 }
 
 func (msc MicroserviceClient) Put(path string, payload interface{}, ret interface{}) error {
-	u := msc.getUrl(path)
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return err
-	}
+	return msc.PutCtx(context.Background(), path, payload, ret)
+}
 
-	request, err := http.NewRequest("PUT", u, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return err
-	}
+func (msc MicroserviceClient) PutCtx(ctx context.Context, path string, payload interface{}, ret interface{}) error {
+	return msc.sendPayload(ctx, http.MethodPut, path, payload, ret)
+}
 
-	if msc.PermanentUrlParams != nil && len(msc.PermanentUrlParams) > 0 {
-		request.URL.RawQuery = msc.PermanentUrlParams.Encode()
-	}
+func (msc MicroserviceClient) Patch(path string, payload interface{}, ret interface{}) error {
+	return msc.PatchCtx(context.Background(), path, payload, ret)
+}
 
-	request.Header.Set("Content-Type", "application/json; charset=UTF-8")
-	msc.fillPermanentHeaders(request)
+func (msc MicroserviceClient) PatchCtx(ctx context.Context, path string, payload interface{}, ret interface{}) error {
+	return msc.sendPayload(ctx, http.MethodPatch, path, payload, ret)
+}
 
-	client := &http.Client{}
-	if msc.TimeOut > 0 {
-		client.Timeout = msc.TimeOut
+func (msc MicroserviceClient) Get(path string, ret interface{}, VV url.Values) error {
+	return msc.GetCtx(context.Background(), path, ret, VV)
+}
+
+func (msc MicroserviceClient) GetCtx(ctx context.Context, path string, ret interface{}, VV url.Values) error {
+	u := msc.getUrl(path)
+
+	if msc.PermanentUrlParams != nil && len(msc.PermanentUrlParams) > 0 {
+		if VV == nil {
+			VV = url.Values{}
+		}
+		for k, vv := range msc.PermanentUrlParams {
+			for _, v := range vv {
+				VV.Add(k, v)
+			}
+		}
 	}
-	response, err := client.Do(request)
+
+	response, cancel, err := msc.do(ctx, http.MethodGet, u, nil, VV)
 	if err != nil {
 		return err
 	}
+	defer cancel()
 	defer func() {
 		_ = response.Body.Close()
 	}()
 
-	if response.StatusCode != http.StatusOK {
-		if msc.ErrorParser != nil {
-			return msc.ErrorParser(response)
-		}
-		return ServiceResponse2Error(response)
+	if response.StatusCode == http.StatusNotFound && msc.ErrorParser != nil {
+		//Custom parsers have never been given the 404s of GET, the default one reads their envelope
+		return NotFound{}
 	}
 
-	if ret == nil {
-		//Nothing to parse
-		return nil
-	}
+	return msc.parseResponse(response, ret)
+}
+
+func (msc MicroserviceClient) Delete(path string, ret interface{}) error {
+	return msc.DeleteCtx(context.Background(), path, ret)
+}
 
-	err = DecodeResponseBody(response, ret)
+func (msc MicroserviceClient) DeleteCtx(ctx context.Context, path string, ret interface{}) error {
+	u := msc.getUrl(path)
+
+	response, cancel, err := msc.do(ctx, http.MethodDelete, u, nil, nil)
 	if err != nil {
 		return err
 	}
+	defer cancel()
+	defer func() {
+		_ = response.Body.Close()
+	}()
 
-	return nil
+	return msc.parseResponse(response, ret)
 }
 
-func (msc MicroserviceClient) Patch(path string, payload interface{}, ret interface{}) error {
+func (msc MicroserviceClient) sendPayload(ctx context.Context, method string, path string, payload interface{}, ret interface{}) error {
 	u := msc.getUrl(path)
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
 		return err
 	}
 
-	request, err := http.NewRequest("PATCH", u, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return err
-	}
-
-	if msc.PermanentUrlParams != nil && len(msc.PermanentUrlParams) > 0 {
-		request.URL.RawQuery = msc.PermanentUrlParams.Encode()
-	}
-
-	request.Header.Set("Content-Type", "application/json; charset=UTF-8")
-	msc.fillPermanentHeaders(request)
-
-	client := &http.Client{}
-	if msc.TimeOut > 0 {
-		client.Timeout = msc.TimeOut
-	}
-	response, err := client.Do(request)
+	response, cancel, err := msc.do(ctx, method, u, jsonData, msc.PermanentUrlParams)
 	if err != nil {
 		return err
 	}
+	defer cancel()
 	defer func() {
 		_ = response.Body.Close()
 	}()
 
+	return msc.parseResponse(response, ret)
+}
+
+func (msc MicroserviceClient) parseResponse(response *http.Response, ret interface{}) error {
 	if response.StatusCode != http.StatusOK {
 		if msc.ErrorParser != nil {
 			return msc.ErrorParser(response)
@@ -164,124 +194,115 @@ func (msc MicroserviceClient) Patch(path string, payload interface{}, ret interf
 		return nil
 	}
 
-	err = DecodeResponseBody(response, ret)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return DecodeResponseBody(response, ret)
 }
 
-func (msc MicroserviceClient) Get(path string, ret interface{}, VV url.Values) error {
-	u := msc.getUrl(path)
-	request, err := http.NewRequest("GET", u, bytes.NewBuffer([]byte("")))
-	if err != nil {
-		return err
-	}
+// do sends the request applying the bulkhead, the circuit breaker and the retry policy.
+// The returned cancel func releases the per-attempt timeout and the bulkhead slot, it must be called once the body has been read
+func (msc MicroserviceClient) do(ctx context.Context, method string, u string, body []byte, query url.Values) (*http.Response, context.CancelFunc, error) {
+	target := breakerTarget(u)
 
-	if msc.PermanentUrlParams != nil && len(msc.PermanentUrlParams) > 0 {
-		if VV == nil {
-			VV = url.Values{}
+	release := func() {}
+	if msc.Bulkhead != nil {
+		r, err := msc.Bulkhead.Acquire(ctx, target)
+		if err != nil {
+			return nil, nil, err
 		}
-		for k, vv := range msc.PermanentUrlParams {
-			for _, v := range vv {
-				VV.Add(k, v)
+		release = r
+	}
+
+	for attempt := 1; ; attempt++ {
+		var cb *CircuitBreaker
+		var done func(bool)
+		if msc.Breakers != nil {
+			cb = msc.Breakers.Get(target)
+			d, err := cb.Allow()
+			if err != nil {
+				release()
+				return nil, nil, err
 			}
+			done = d
 		}
-	}
 
-	if VV != nil && len(VV) > 0 {
-		request.URL.RawQuery = VV.Encode()
-	}
-
-	request.Header.Set("Content-Type", "application/json; charset=UTF-8")
-	msc.fillPermanentHeaders(request)
+		response, cancel, err := msc.send(ctx, method, u, body, query)
+		if done != nil {
+			if callerGaveUp(ctx, err) {
+				cb.abandon()
+			} else {
+				done(isBreakerFailure(response, err))
+			}
+		}
 
-	client := &http.Client{}
-	if msc.TimeOut > 0 {
-		client.Timeout = msc.TimeOut
-	}
-	response, err := client.Do(request)
-	if err != nil {
-		return err
-	}
-	defer func() {
-		_ = response.Body.Close()
-	}()
+		if !msc.Retry.shouldRetry(ctx, method, attempt, response, err) {
+			if err != nil {
+				release()
+				return nil, nil, err
+			}
+			return response, func() {
+				cancel()
+				release()
+			}, nil
+		}
 
-	if response.StatusCode == http.StatusNotFound {
-		return NotFound{}
-	}
+		if response != nil {
+			//Drain the body so that the connection can be reused
+			_, _ = io.Copy(io.Discard, response.Body)
+			_ = response.Body.Close()
+		}
+		cancel()
 
-	if response.StatusCode != http.StatusOK {
-		if msc.ErrorParser != nil {
-			return msc.ErrorParser(response)
+		if err := msc.Retry.wait(ctx, attempt); err != nil {
+			release()
+			return nil, nil, err
 		}
-		return ServiceResponse2Error(response)
 	}
+}
 
-	if ret == nil {
-		//Nothing to parse
-		return nil
+func (msc MicroserviceClient) send(ctx context.Context, method string, u string, body []byte, query url.Values) (*http.Response, context.CancelFunc, error) {
+	cancel := context.CancelFunc(func() {})
+	if msc.TimeOut > 0 {
+		ctx, cancel = context.WithTimeout(ctx, msc.TimeOut)
 	}
 
-	err = DecodeResponseBody(response, ret)
+	request, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
 	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (msc MicroserviceClient) fillPermanentHeaders(req *http.Request) {
-	if msc.PermanentHeaders == nil {
-		return
+		cancel()
+		return nil, cancel, err
 	}
-	for k, v := range msc.PermanentHeaders {
-		req.Header.Set(k, v)
-	}
-}
 
-func (msc MicroserviceClient) Delete(path string, ret interface{}) error {
-	u := msc.getUrl(path)
-	request, err := http.NewRequest("DELETE", u, bytes.NewBuffer([]byte("")))
-	if err != nil {
-		return err
+	if len(query) > 0 {
+		request.URL.RawQuery = query.Encode()
 	}
 
 	request.Header.Set("Content-Type", "application/json; charset=UTF-8")
 	msc.fillPermanentHeaders(request)
+	correlation.InjectHeader(ctx, request.Header)
 
-	client := &http.Client{}
-	if msc.TimeOut > 0 {
-		client.Timeout = msc.TimeOut
-	}
-	response, err := client.Do(request)
+	_, span := tracing.StartClient(ctx, request)
+	response, err := msc.httpClient().Do(request)
+	tracing.EndClient(span, response, err)
 	if err != nil {
-		return err
+		cancel()
+		return nil, cancel, err
 	}
-	defer func() {
-		_ = response.Body.Close()
-	}()
 
-	if response.StatusCode != http.StatusOK {
-		if msc.ErrorParser != nil {
-			return msc.ErrorParser(response)
-		}
-		return ServiceResponse2Error(response)
-	}
+	return response, cancel, nil
+}
 
-	if ret == nil {
-		//Nothing to parse
-		return nil
+func (msc MicroserviceClient) httpClient() *http.Client {
+	if msc.HttpClient != nil {
+		return msc.HttpClient
 	}
+	return DefaultMicroserviceHttpClient
+}
 
-	err = DecodeResponseBody(response, ret)
-	if err != nil {
-		return err
+func (msc MicroserviceClient) fillPermanentHeaders(req *http.Request) {
+	if msc.PermanentHeaders == nil {
+		return
+	}
+	for k, v := range msc.PermanentHeaders {
+		req.Header.Set(k, v)
 	}
-
-	return nil
 }
 
 func (msc MicroserviceClient) getUrl(path string) string {
@@ -301,3 +322,12 @@ type HttpMicroClient interface {
 	Get(url string, ret interface{}, VV url.Values) error
 	Delete(url string, ret interface{}) error
 }
+
+type HttpMicroClientCtx interface {
+	HttpMicroClient
+	PostCtx(ctx context.Context, url string, payload interface{}, ret interface{}) error
+	PutCtx(ctx context.Context, url string, payload interface{}, ret interface{}) error
+	PatchCtx(ctx context.Context, url string, payload interface{}, ret interface{}) error
+	GetCtx(ctx context.Context, url string, ret interface{}, VV url.Values) error
+	DeleteCtx(ctx context.Context, url string, ret interface{}) error
+}
@@ -0,0 +1,375 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/4books-sparta/utils/instruments"
+)
+
+type CircuitState int
+
+const (
+	ErrorInvalidBulkheadSize = "bulkhead-needs-positive-concurrency"
+)
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+
+	return "closed"
+}
+
+type CircuitOpenError struct {
+	Target string
+}
+
+func (e CircuitOpenError) Error() string {
+	return "circuit-open"
+}
+
+func (e CircuitOpenError) Code() int {
+	return http.StatusServiceUnavailable
+}
+
+type BulkheadFullError struct {
+	Target string
+}
+
+func (e BulkheadFullError) Error() string {
+	return "bulkhead-full"
+}
+
+func (e BulkheadFullError) Code() int {
+	return http.StatusServiceUnavailable
+}
+
+type CircuitBreakerConfig struct {
+	// Window is the period over which calls are counted before the counters are reset
+	Window time.Duration
+	// MinRequests is the number of calls needed in a window before the thresholds are evaluated
+	MinRequests int
+	// ErrorRate is the failed calls ratio (0-1] that opens the circuit
+	ErrorRate float64
+	// SlowCall is the latency over which a call is considered slow, 0 disables the check
+	SlowCall time.Duration
+	// SlowCallRate is the slow calls ratio (0-1] that opens the circuit
+	SlowCallRate float64
+	// OpenTimeout is how long the circuit stays open before letting probes through
+	OpenTimeout time.Duration
+	// HalfOpenMaxCalls is the number of successful probes needed to close the circuit
+	HalfOpenMaxCalls int
+}
+
+func DefaultCircuitBreakerConfig() CircuitBreakerConfig {
+	return CircuitBreakerConfig{
+		Window:           10 * time.Second,
+		MinRequests:      20,
+		ErrorRate:        0.5,
+		SlowCall:         0,
+		SlowCallRate:     1,
+		OpenTimeout:      30 * time.Second,
+		HalfOpenMaxCalls: 1,
+	}
+}
+
+type CircuitBreaker struct {
+	target  string
+	cfg     CircuitBreakerConfig
+	metrics *instruments.CircuitMetric
+	now     func() time.Time
+
+	mu          sync.Mutex
+	state       CircuitState
+	openedAt    time.Time
+	windowStart time.Time
+	calls       int
+	failures    int
+	slow        int
+	probes      int
+	probesOk    int
+}
+
+func NewCircuitBreaker(target string, cfg CircuitBreakerConfig, met *instruments.CircuitMetric) *CircuitBreaker {
+	if cfg.HalfOpenMaxCalls <= 0 {
+		cfg.HalfOpenMaxCalls = 1
+	}
+	cb := &CircuitBreaker{
+		target:  target,
+		cfg:     cfg,
+		metrics: met,
+		now:     time.Now,
+	}
+	cb.windowStart = cb.now()
+	cb.reportState()
+
+	return cb
+}
+
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	return cb.currentState()
+}
+
+// Allow returns a CircuitOpenError when the call must not be done,
+// otherwise a func to be invoked with the outcome of the call
+func (cb *CircuitBreaker) Allow() (func(failed bool), error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.currentState() {
+	case CircuitOpen:
+		cb.reportRejected("circuit")
+		return nil, CircuitOpenError{Target: cb.target}
+	case CircuitHalfOpen:
+		if cb.probes >= cb.cfg.HalfOpenMaxCalls {
+			cb.reportRejected("circuit")
+			return nil, CircuitOpenError{Target: cb.target}
+		}
+		cb.probes++
+	}
+
+	begin := cb.now()
+	return func(failed bool) {
+		cb.record(cb.now().Sub(begin), failed)
+	}, nil
+}
+
+// abandon forgets a call the caller gave up on, freeing its half-open probe slot
+func (cb *CircuitBreaker) abandon() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.currentState() == CircuitHalfOpen && cb.probes > 0 {
+		cb.probes--
+	}
+}
+
+func (cb *CircuitBreaker) record(d time.Duration, failed bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	slow := cb.cfg.SlowCall > 0 && d > cb.cfg.SlowCall
+
+	if cb.currentState() == CircuitHalfOpen {
+		if failed || slow {
+			cb.setState(CircuitOpen)
+			return
+		}
+		cb.probesOk++
+		if cb.probesOk >= cb.cfg.HalfOpenMaxCalls {
+			cb.setState(CircuitClosed)
+		}
+		return
+	}
+
+	if cb.state != CircuitClosed {
+		//The outcome of a call started before the circuit opened
+		return
+	}
+
+	now := cb.now()
+	if cb.cfg.Window > 0 && now.Sub(cb.windowStart) > cb.cfg.Window {
+		cb.resetCounters(now)
+	}
+
+	cb.calls++
+	if failed {
+		cb.failures++
+	}
+	if slow {
+		cb.slow++
+	}
+
+	if cb.calls < cb.cfg.MinRequests {
+		return
+	}
+
+	if cb.cfg.ErrorRate > 0 && float64(cb.failures)/float64(cb.calls) >= cb.cfg.ErrorRate {
+		cb.setState(CircuitOpen)
+		return
+	}
+	if cb.cfg.SlowCall > 0 && cb.cfg.SlowCallRate > 0 && float64(cb.slow)/float64(cb.calls) >= cb.cfg.SlowCallRate {
+		cb.setState(CircuitOpen)
+	}
+}
+
+// currentState moves an open circuit to half-open once OpenTimeout has elapsed, mu must be held
+func (cb *CircuitBreaker) currentState() CircuitState {
+	if cb.state == CircuitOpen && cb.now().Sub(cb.openedAt) >= cb.cfg.OpenTimeout {
+		cb.setState(CircuitHalfOpen)
+	}
+
+	return cb.state
+}
+
+func (cb *CircuitBreaker) setState(s CircuitState) {
+	if cb.state == s {
+		return
+	}
+
+	now := cb.now()
+	cb.state = s
+	cb.probes = 0
+	cb.probesOk = 0
+	if s == CircuitOpen {
+		cb.openedAt = now
+	}
+	cb.resetCounters(now)
+
+	if cb.metrics != nil {
+		cb.metrics.Transitions.With("target", cb.target, "state", s.String()).Add(1)
+	}
+	cb.reportState()
+}
+
+func (cb *CircuitBreaker) resetCounters(now time.Time) {
+	cb.windowStart = now
+	cb.calls = 0
+	cb.failures = 0
+	cb.slow = 0
+}
+
+func (cb *CircuitBreaker) reportState() {
+	if cb.metrics == nil {
+		return
+	}
+	cb.metrics.State.With("target", cb.target).Set(float64(cb.state))
+}
+
+func (cb *CircuitBreaker) reportRejected(reason string) {
+	if cb.metrics == nil {
+		return
+	}
+	cb.metrics.Rejected.With("target", cb.target, "reason", reason).Add(1)
+}
+
+// CircuitBreakers holds one breaker per target host
+type CircuitBreakers struct {
+	cfg      CircuitBreakerConfig
+	metrics  *instruments.CircuitMetric
+	mu       sync.Mutex
+	breakers map[string]*CircuitBreaker
+}
+
+func NewCircuitBreakers(cfg CircuitBreakerConfig, met *instruments.CircuitMetric) *CircuitBreakers {
+	return &CircuitBreakers{
+		cfg:      cfg,
+		metrics:  met,
+		breakers: make(map[string]*CircuitBreaker),
+	}
+}
+
+func (g *CircuitBreakers) Get(target string) *CircuitBreaker {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	cb, ok := g.breakers[target]
+	if !ok {
+		cb = NewCircuitBreaker(target, g.cfg, g.metrics)
+		g.breakers[target] = cb
+	}
+
+	return cb
+}
+
+func (g *CircuitBreakers) States() map[string]CircuitState {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ret := make(map[string]CircuitState, len(g.breakers))
+	for t, cb := range g.breakers {
+		ret[t] = cb.State()
+	}
+
+	return ret
+}
+
+// Bulkhead limits the number of concurrent calls to a downstream service
+type Bulkhead struct {
+	sem     chan struct{}
+	maxWait time.Duration
+	metrics *instruments.CircuitMetric
+}
+
+func NewBulkhead(maxConcurrent int, maxWait time.Duration, met *instruments.CircuitMetric) (*Bulkhead, error) {
+	if maxConcurrent <= 0 {
+		return nil, errors.New(ErrorInvalidBulkheadSize)
+	}
+
+	return &Bulkhead{
+		sem:     make(chan struct{}, maxConcurrent),
+		maxWait: maxWait,
+		metrics: met,
+	}, nil
+}
+
+// Acquire waits at most maxWait for a free slot, the returned func releases it
+func (b *Bulkhead) Acquire(ctx context.Context, target string) (func(), error) {
+	release := func() {
+		<-b.sem
+	}
+
+	select {
+	case b.sem <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	if b.maxWait > 0 {
+		t := time.NewTimer(b.maxWait)
+		defer t.Stop()
+
+		select {
+		case b.sem <- struct{}{}:
+			return release, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+
+	if b.metrics != nil {
+		b.metrics.Rejected.With("target", target, "reason", "bulkhead").Add(1)
+	}
+
+	return nil, BulkheadFullError{Target: target}
+}
+
+func (b *Bulkhead) InFlight() int {
+	return len(b.sem)
+}
+
+func breakerTarget(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" {
+		return u
+	}
+
+	return parsed.Host
+}
+
+func isBreakerFailure(res *http.Response, err error) bool {
+	return err != nil || res.StatusCode >= http.StatusInternalServerError
+}
+
+// callerGaveUp tells the calls cancelled by the caller, which say nothing about the health of the target
+func callerGaveUp(ctx context.Context, err error) bool {
+	return err != nil && (errors.Is(err, context.Canceled) || ctx.Err() != nil)
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/4books-sparta/utils/instruments"
+)
+
+func TestCircuitBreakerLifecycle(t *testing.T) {
+	now := time.Now()
+	cfg := DefaultCircuitBreakerConfig()
+	cfg.MinRequests = 4
+	cb := NewCircuitBreaker("svc", cfg, instruments.DummyCircuitMetric("test"))
+	cb.now = func() time.Time { return now }
+
+	for i := 0; i < 4; i++ {
+		done, err := cb.Allow()
+		assert.Nil(t, err)
+		done(i%2 == 0)
+	}
+	assert.Equal(t, CircuitOpen, cb.State())
+
+	_, err := cb.Allow()
+	var open CircuitOpenError
+	assert.True(t, errors.As(err, &open))
+	assert.Equal(t, http.StatusServiceUnavailable, open.Code())
+
+	now = now.Add(cfg.OpenTimeout)
+	assert.Equal(t, CircuitHalfOpen, cb.State())
+
+	done, err := cb.Allow()
+	assert.Nil(t, err)
+	_, err = cb.Allow()
+	assert.NotNil(t, err, "only one probe is allowed while half-open")
+
+	done(false)
+	assert.Equal(t, CircuitClosed, cb.State())
+}
+
+func TestMicroserviceClientOpensCircuit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"message":"boom"}`))
+	}))
+	defer srv.Close()
+
+	cfg := DefaultCircuitBreakerConfig()
+	cfg.MinRequests = 2
+	msc := MicroserviceClient{Url: srv.URL, Breakers: NewCircuitBreakers(cfg, nil)}
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, "boom", msc.Get("/", nil, nil).Error())
+	}
+
+	err := msc.Get("/", nil, nil)
+	assert.IsType(t, CircuitOpenError{}, err)
+}
+
+func TestCancelledCallsDoNotOpenCircuit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	cfg := DefaultCircuitBreakerConfig()
+	cfg.MinRequests = 2
+	msc := MicroserviceClient{Url: srv.URL, Breakers: NewCircuitBreakers(cfg, nil)}
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		assert.NotNil(t, msc.GetCtx(ctx, "/", nil, nil))
+		cancel()
+	}
+	assert.Equal(t, CircuitClosed, msc.Breakers.Get(breakerTarget(srv.URL)).State())
+}
+
+func TestBulkheadRejectsWhenFull(t *testing.T) {
+	_, err := NewBulkhead(0, time.Millisecond, nil)
+	assert.NotNil(t, err)
+
+	b, err := NewBulkhead(1, time.Millisecond, nil)
+	assert.Nil(t, err)
+
+	release, err := b.Acquire(context.Background(), "svc")
+	assert.Nil(t, err)
+
+	_, err = b.Acquire(context.Background(), "svc")
+	assert.IsType(t, BulkheadFullError{}, err)
+
+	release()
+	_, err = b.Acquire(context.Background(), "svc")
+	assert.Nil(t, err)
+}
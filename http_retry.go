@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+const (
+	RetrySafeCtxKey = "req-retry-safe"
+)
+
+type BackoffPolicy interface {
+	// Backoff returns the delay to wait after the given (1 based) failed attempt
+	Backoff(attempt int) time.Duration
+}
+
+type ConstantBackoff struct {
+	Interval time.Duration
+}
+
+func (b ConstantBackoff) Backoff(_ int) time.Duration {
+	return b.Interval
+}
+
+type ExponentialBackoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	// Jitter is the randomized fraction of each delay, between 0 and 1
+	Jitter float64
+}
+
+func (b ExponentialBackoff) Backoff(attempt int) time.Duration {
+	mul := b.Multiplier
+	if mul < 1 {
+		mul = 2
+	}
+
+	d := float64(b.Initial) * math.Pow(mul, float64(attempt-1))
+	if b.Max > 0 && d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+
+	if b.Jitter > 0 {
+		j := math.Min(b.Jitter, 1)
+		d = d*(1-j) + d*j*rand.Float64()
+	}
+
+	return time.Duration(d)
+}
+
+type RetryPolicy struct {
+	// MaxAttempts includes the first call
+	MaxAttempts int
+	Backoff     BackoffPolicy
+	// RetryOnStatus lists the response codes considered transient
+	RetryOnStatus []int
+	// RetryUnsafe allows retrying POST and PATCH calls without marking them with WithRetrySafe
+	RetryUnsafe bool
+}
+
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 3,
+		Backoff: ExponentialBackoff{
+			Initial:    100 * time.Millisecond,
+			Max:        2 * time.Second,
+			Multiplier: 2,
+			Jitter:     0.5,
+		},
+		RetryOnStatus: []int{
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+// WithRetrySafe marks the calls made with the returned context as safe to be repeated,
+// even if their method is not idempotent
+func WithRetrySafe(ctx context.Context) context.Context {
+	return context.WithValue(ctx, RetrySafeCtxKey, true)
+}
+
+func IsRetrySafeContext(ctx context.Context) bool {
+	v, ok := ctx.Value(RetrySafeCtxKey).(bool)
+	if !ok {
+		return false
+	}
+
+	return v
+}
+
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+func (p *RetryPolicy) shouldRetry(ctx context.Context, method string, attempt int, res *http.Response, err error) bool {
+	if p == nil || attempt >= p.MaxAttempts {
+		return false
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+	if !p.RetryUnsafe && !isIdempotentMethod(method) && !IsRetrySafeContext(ctx) {
+		return false
+	}
+
+	if err != nil {
+		//Connection errors and per attempt timeouts are transient, the caller's context was checked above
+		return true
+	}
+
+	for _, s := range p.RetryOnStatus {
+		if res.StatusCode == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *RetryPolicy) wait(ctx context.Context, attempt int) error {
+	if p.Backoff == nil {
+		return ctx.Err()
+	}
+
+	return sleepCtx(ctx, p.Backoff.Backoff(attempt))
+}
+
+// sleepCtx waits for d, or less when ctx is done
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,225 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/4books-sparta/utils/correlation"
+	"github.com/4books-sparta/utils/tracing"
+)
+
+func flakyServer(failures int32, status int) (*httptest.Server, *int32) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= failures {
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{"message":"unavailable"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"done":true}`))
+	}))
+
+	return srv, &calls
+}
+
+func testRetryPolicy() *RetryPolicy {
+	p := DefaultRetryPolicy()
+	p.Backoff = ConstantBackoff{Interval: time.Millisecond}
+	return p
+}
+
+func TestMicroserviceClientRetriesIdempotentCalls(t *testing.T) {
+	srv, calls := flakyServer(2, http.StatusServiceUnavailable)
+	defer srv.Close()
+
+	msc := MicroserviceClient{Url: srv.URL, Retry: testRetryPolicy()}
+	ret := struct {
+		Done bool `json:"done"`
+	}{}
+
+	err := msc.GetCtx(context.Background(), "/", &ret, nil)
+	assert.Nil(t, err)
+	assert.True(t, ret.Done)
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+}
+
+func TestMicroserviceClientDoesNotRetryUnsafeCalls(t *testing.T) {
+	srv, calls := flakyServer(1, http.StatusBadGateway)
+	defer srv.Close()
+
+	msc := MicroserviceClient{Url: srv.URL, Retry: testRetryPolicy()}
+
+	err := msc.PostCtx(context.Background(), "/", map[string]string{}, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+
+	err = msc.PostCtx(WithRetrySafe(context.Background()), "/", map[string]string{}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+func TestMicroserviceClientStopsAfterMaxAttempts(t *testing.T) {
+	srv, calls := flakyServer(10, http.StatusServiceUnavailable)
+	defer srv.Close()
+
+	msc := MicroserviceClient{Url: srv.URL, Retry: testRetryPolicy()}
+
+	err := msc.Delete("/", nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+}
+
+func TestCustomErrorParserKeepsGetNotFound(t *testing.T) {
+	srv, _ := flakyServer(10, http.StatusNotFound)
+	defer srv.Close()
+
+	var parsed int32
+	msc := MicroserviceClient{Url: srv.URL, ErrorParser: func(res *http.Response) error {
+		atomic.AddInt32(&parsed, 1)
+		return errors.New("parsed")
+	}}
+
+	assert.Equal(t, NotFound{}, msc.Get("/", nil, nil))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&parsed))
+	assert.EqualError(t, msc.Delete("/", nil), "parsed")
+}
+
+func TestExponentialBackoffIsCapped(t *testing.T) {
+	b := ExponentialBackoff{Initial: 100 * time.Millisecond, Max: time.Second, Multiplier: 2}
+
+	assert.Equal(t, 100*time.Millisecond, b.Backoff(1))
+	assert.Equal(t, 400*time.Millisecond, b.Backoff(3))
+	assert.Equal(t, time.Second, b.Backoff(10))
+}
+
+func TestRequestIdIsPropagated(t *testing.T) {
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`"` + r.Header.Get(correlation.HeaderRequestID) + `"`))
+	}))
+	defer downstream.Close()
+
+	e := func(ctx context.Context, request interface{}) (interface{}, error) {
+		var forwarded string
+		err := MicroserviceClient{Url: downstream.URL}.GetCtx(ctx, "/", &forwarded, nil)
+		return forwarded, err
+	}
+	dec := func(context.Context, *http.Request) (interface{}, error) {
+		return nil, nil
+	}
+	srv := httptest.NewServer(NewForwarder(nil).Forward(e, dec))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set(correlation.HeaderRequestID, "abc-123")
+	res, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer res.Body.Close()
+
+	var forwarded string
+	_ = json.NewDecoder(res.Body).Decode(&forwarded)
+	assert.Equal(t, "abc-123", forwarded)
+	assert.Equal(t, "abc-123", res.Header.Get(correlation.HeaderRequestID))
+}
+
+func TestTracingSpansAreLinkedAcrossServices(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracing.Enable(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)), nil)
+	defer tracing.Disable()
+
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`"` + r.Header.Get("traceparent") + `"`))
+	}))
+	defer downstream.Close()
+
+	e := func(ctx context.Context, request interface{}) (interface{}, error) {
+		var traceparent string
+		err := MicroserviceClient{Url: downstream.URL}.GetCtx(ctx, "/", &traceparent, nil)
+		return traceparent, err
+	}
+	dec := func(context.Context, *http.Request) (interface{}, error) {
+		return nil, nil
+	}
+	srv := httptest.NewServer(NewForwarder(nil).Forward(e, dec))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/books")
+	assert.Nil(t, err)
+	var traceparent string
+	_ = json.NewDecoder(res.Body).Decode(&traceparent)
+	_ = res.Body.Close()
+
+	spans := exporter.GetSpans()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+	client, server := spans[0], spans[1]
+	assert.Equal(t, trace.SpanKindClient, client.SpanKind)
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind)
+	assert.Equal(t, "GET /books", server.Name)
+	assert.Equal(t, server.SpanContext.SpanID(), client.Parent.SpanID())
+	assert.Contains(t, traceparent, client.SpanContext.TraceID().String())
+}
+
+func TestTracedStreamsFlushAndKeepOuterSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracing.Enable(tp, nil)
+	defer tracing.Disable()
+
+	rows := make([]int, 250)
+	e := func(ctx context.Context, request interface{}) (interface{}, error) {
+		return StreamResponse{Items: StreamFromSlice(rows)}, nil
+	}
+	dec := func(context.Context, *http.Request) (interface{}, error) {
+		return nil, nil
+	}
+	h := NewForwarderWithResponseType(nil, ApiResponseTypeNdjson).Forward(e, dec)
+
+	ctx, outer := tp.Tracer("outer").Start(context.Background(), "outer")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/export", nil).WithContext(ctx))
+
+	assert.True(t, w.Flushed)
+	assert.True(t, outer.IsRecording(), "only the span of the Forwarder is ended")
+	outer.End()
+	assert.Len(t, exporter.GetSpans(), 2)
+}
+
+func TestHandlersBuiltBeforeTracingEndTheirSpans(t *testing.T) {
+	e := func(ctx context.Context, request interface{}) (interface{}, error) {
+		if request == "fail" {
+			return nil, NotFound{}
+		}
+		return "ok", nil
+	}
+	dec := func(_ context.Context, r *http.Request) (interface{}, error) {
+		return r.URL.Query().Get("q"), nil
+	}
+	h := NewForwarder(nil).Forward(e, dec)
+
+	exporter := tracetest.NewInMemoryExporter()
+	tracing.Enable(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)), nil)
+	defer tracing.Disable()
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/books", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/books?q=fail", nil))
+
+	spans := exporter.GetSpans()
+	if !assert.Len(t, spans, 2, "every server span is ended") {
+		return
+	}
+	assert.Contains(t, spans[0].Attributes, attribute.Int("http.response.status_code", http.StatusOK))
+	assert.Contains(t, spans[1].Attributes, attribute.Int("http.response.status_code", http.StatusNotFound))
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// HttpMicroCaller sends the requests of Call, MicroserviceClient implements it
+type HttpMicroCaller interface {
+	// CallCtx returns the body of a 200 response, the other statuses are returned as errors
+	CallCtx(ctx context.Context, method string, path string, query url.Values, body []byte) ([]byte, error)
+}
+
+// Call sends req to path and decodes the response body into a Res.
+// GET and DELETE requests are encoded in the query string through EncodeQuery,
+// the other methods send req as JSON body. Use struct{} when there is nothing to send or to read
+func Call[Req, Res any](ctx context.Context, client HttpMicroCaller, method string, path string, req Req) (Res, error) {
+	var res Res
+
+	var query url.Values
+	var body []byte
+
+	switch method {
+	case http.MethodGet, http.MethodDelete, http.MethodHead:
+		vv, err := EncodeQuery(req)
+		if err != nil {
+			return res, InvalidRequestError{Err: err}
+		}
+		query = vv
+	default:
+		b, err := json.Marshal(req)
+		if err != nil {
+			return res, err
+		}
+		body = b
+	}
+
+	b, err := client.CallCtx(ctx, method, path, query, body)
+	if err != nil {
+		return res, err
+	}
+	if len(bytes.TrimSpace(b)) == 0 {
+		//Nothing to parse
+		return res, nil
+	}
+
+	return res, json.Unmarshal(b, &res)
+}
+
+func CallGet[Req, Res any](ctx context.Context, client HttpMicroCaller, path string, query Req) (Res, error) {
+	return Call[Req, Res](ctx, client, http.MethodGet, path, query)
+}
+
+func CallPost[Req, Res any](ctx context.Context, client HttpMicroCaller, path string, req Req) (Res, error) {
+	return Call[Req, Res](ctx, client, http.MethodPost, path, req)
+}
+
+// CallCtx implements HttpMicroCaller, the permanent url params are added to query
+func (msc MicroserviceClient) CallCtx(ctx context.Context, method string, path string, query url.Values, body []byte) ([]byte, error) {
+	vv := url.Values{}
+	for _, src := range []url.Values{query, msc.PermanentUrlParams} {
+		for k, ss := range src {
+			for _, v := range ss {
+				vv.Add(k, v)
+			}
+		}
+	}
+
+	response, cancel, err := msc.do(ctx, method, msc.getUrl(path), body, vv)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, msc.parseResponse(response, nil)
+	}
+
+	return io.ReadAll(response.Body)
+}
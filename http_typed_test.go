@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testBookFilter struct {
+	Lang  string    `query:"lang"`
+	Ids   []int     `query:"ids"`
+	From  time.Time `query:"from,date,omitempty"`
+	Skip  string    `query:"-"`
+	Limit uint      `json:"limit"`
+	Score float32   `query:"score,omitempty"`
+}
+
+type testBook struct {
+	Id    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+func TestEncodeQuery(t *testing.T) {
+	vv, err := EncodeQuery(testBookFilter{
+		Lang:  "it",
+		Ids:   []int{1, 2},
+		From:  time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		Skip:  "x",
+		Limit: 10,
+		Score: 0.1,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, url.Values{
+		"lang":  {"it"},
+		"ids":   {"1", "2"},
+		"from":  {"2024-03-01"},
+		"limit": {"10"},
+		"score": {"0.1"},
+	}, vv)
+}
+
+func TestCall(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "yes", r.Header.Get("X-Test"))
+		assert.Equal(t, "v1", r.URL.Query().Get("api"))
+
+		if r.Method == http.MethodGet {
+			assert.Equal(t, "it", r.URL.Query().Get("lang"))
+			_ = json.NewEncoder(w).Encode([]testBook{{Id: 1, Title: "Book"}})
+			return
+		}
+
+		in := testBook{}
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		assert.Equal(t, "New", in.Title)
+	}))
+	defer srv.Close()
+
+	msc := MicroserviceClient{
+		Url:                srv.URL,
+		PermanentHeaders:   map[string]string{"X-Test": "yes"},
+		PermanentUrlParams: url.Values{"api": {"v1"}},
+	}
+
+	books, err := CallGet[testBookFilter, []testBook](context.Background(), msc, "/books", testBookFilter{Lang: "it"})
+	assert.Nil(t, err)
+	assert.Equal(t, []testBook{{Id: 1, Title: "Book"}}, books)
+
+	_, err = CallPost[testBook, struct{}](context.Background(), msc, "/books", testBook{Title: "New"})
+	assert.Nil(t, err)
+}
@@ -0,0 +1,200 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/message/catalog"
+)
+
+const (
+	ErrorInvalidCatalog = "invalid-message-catalog"
+)
+
+//go:embed messages/*.json
+var messages embed.FS
+
+// Catalog translates message keys, such as the error keys sent to the clients.
+// Messages are fmt formats, plural ones select their case on the first argument.
+type Catalog struct {
+	mu      sync.RWMutex
+	builder *catalog.Builder
+	// keys tells the missing translations apart, the printer would print the key itself
+	keys map[string]map[string]struct{}
+}
+
+var (
+	defaultCatalog     *Catalog
+	defaultCatalogOnce sync.Once
+)
+
+// Default returns the catalog of the embedded messages, services can extend it with Load or Set
+func Default() *Catalog {
+	defaultCatalogOnce.Do(func() {
+		defaultCatalog = New()
+		if err := defaultCatalog.Load(messages, "messages"); err != nil {
+			panic(err)
+		}
+	})
+
+	return defaultCatalog
+}
+
+func New() *Catalog {
+	return &Catalog{
+		builder: catalog.NewBuilder(),
+		keys:    map[string]map[string]struct{}{},
+	}
+}
+
+// Load reads the <lang>.json files of dir, each one maps the keys to a string or to plural cases, e.g.
+// {"book-not-found": "Book not found", "retry-in": {"one": "Retry in %d second", "other": "Retry in %d seconds"}}
+func (c *Catalog) Load(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".json" {
+			continue
+		}
+
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+		raw := map[string]json.RawMessage{}
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return fmt.Errorf("%s-%s: %w", ErrorInvalidCatalog, e.Name(), err)
+		}
+
+		lang := strings.TrimSuffix(e.Name(), ".json")
+		for key, m := range raw {
+			if err := c.set(lang, key, m); err != nil {
+				return fmt.Errorf("%s-%s-%s: %w", ErrorInvalidCatalog, lang, key, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Catalog) set(lang, key string, raw json.RawMessage) error {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return c.SetString(lang, key, s)
+	}
+
+	cases := map[string]string{}
+	if err := json.Unmarshal(raw, &cases); err != nil {
+		return err
+	}
+
+	return c.SetPlural(lang, key, cases)
+}
+
+// SetString sets the translation of a key
+func (c *Catalog) SetString(lang, key, msg string) error {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.builder.SetString(tag, key, msg); err != nil {
+		return err
+	}
+	c.addKey(lang, key)
+
+	return nil
+}
+
+// SetPlural sets the translation of a key by the plural form of its first argument,
+// cases are keyed by "zero", "one", "two", "few", "many", "other" or "=n"
+func (c *Catalog) SetPlural(lang, key string, cases map[string]string) error {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return err
+	}
+	if _, ok := cases["other"]; !ok {
+		return fmt.Errorf("plural %s has no other case", key)
+	}
+
+	//Exact values are tried first, other is the last resort
+	selectors := make([]string, 0, len(cases))
+	for s := range cases {
+		selectors = append(selectors, s)
+	}
+	sort.Slice(selectors, func(i, j int) bool {
+		return selectorRank(selectors[i]) < selectorRank(selectors[j]) ||
+			selectorRank(selectors[i]) == selectorRank(selectors[j]) && selectors[i] < selectors[j]
+	})
+	args := make([]interface{}, 0, 2*len(selectors))
+	for _, s := range selectors {
+		args = append(args, s, cases[s])
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.builder.Set(tag, key, plural.Selectf(1, "", args...)); err != nil {
+		return err
+	}
+	c.addKey(lang, key)
+
+	return nil
+}
+
+func selectorRank(s string) int {
+	switch {
+	case strings.HasPrefix(s, "=") || strings.HasPrefix(s, "<"):
+		return 0
+	case s == "other":
+		return 2
+	}
+
+	return 1
+}
+
+func (c *Catalog) addKey(lang, key string) {
+	if c.keys[lang] == nil {
+		c.keys[lang] = map[string]struct{}{}
+	}
+	c.keys[lang][key] = struct{}{}
+}
+
+// Translate formats the key in the first language of the chain having it.
+// A message whose verbs do not match args, e.g. %d without arguments, is skipped instead of printing %!d(MISSING)
+func (c *Catalog) Translate(chain []string, key string, args ...interface{}) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, lang := range chain {
+		if _, ok := c.keys[lang][key]; !ok {
+			continue
+		}
+		tag, err := language.Parse(lang)
+		if err != nil {
+			continue
+		}
+
+		p := message.NewPrinter(tag, message.Catalog(c.builder))
+		if msg := p.Sprintf(key, args...); !strings.Contains(msg, "%!") {
+			return msg, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,43 @@
+package i18n
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCatalog(t *testing.T) {
+	c := New()
+	err := c.Load(fstest.MapFS{
+		"msg/it.json": {Data: []byte(`{"items": {"=0": "Nessun elemento", "one": "Un elemento", "other": "%d elementi di %s"}}`)},
+		"msg/en.json": {Data: []byte(`{"hello": "Hello %s"}`)},
+	}, "msg")
+	assert.Nil(t, err)
+
+	for n, want := range map[int]string{0: "Nessun elemento", 1: "Un elemento", 3: "3 elementi di Anna"} {
+		msg, ok := c.Translate([]string{"it"}, "items", n, "Anna")
+		assert.True(t, ok)
+		assert.Equal(t, want, msg)
+	}
+
+	msg, ok := c.Translate([]string{"it", "en"}, "hello", "Anna")
+	assert.True(t, ok)
+	assert.Equal(t, "Hello Anna", msg)
+	_, ok = c.Translate([]string{"it", "en"}, "missing")
+	assert.False(t, ok)
+
+	assert.NotNil(t, c.Load(fstest.MapFS{"msg/es.json": {Data: []byte(`{"items": {"one": "x"}}`)}}, "msg"))
+
+	msg, ok = Default().Translate([]string{"it"}, "book-not-found")
+	assert.True(t, ok)
+	assert.Equal(t, "Libro non trovato", msg)
+
+	//Verbs without their arguments fall through the chain
+	assert.Nil(t, c.SetString("en", "items", "Items"))
+	msg, ok = c.Translate([]string{"it", "en"}, "items")
+	assert.True(t, ok)
+	assert.Equal(t, "Items", msg)
+	_, ok = c.Translate([]string{"it"}, "items", "Anna")
+	assert.False(t, ok)
+}
@@ -0,0 +1,294 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	kitHttp "github.com/go-kit/kit/transport/http"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	IdempotencyCtxKey    = "req-idempotency-key"
+	// IdempotencyFingerprintCtxKey holds the hash of the query and body of the request
+	IdempotencyFingerprintCtxKey = "req-idempotency-fingerprint"
+	// IdempotencyClientCtxKey holds the address of the caller, it scopes the keys of anonymous requests
+	IdempotencyClientCtxKey = "req-idempotency-client"
+
+	ErrorIdempotencyInFlight  = "idempotent-request-in-flight"
+	ErrorIdempotencyKeyReused = "idempotency-key-reused"
+
+	DefaultIdempotencyTTL     = 24 * time.Hour
+	DefaultIdempotencyLockTTL = time.Minute
+	DefaultIdempotencyMaxBody = 1 << 20
+)
+
+// StoredResponse is the first response given to an idempotency key
+type StoredResponse struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body"`
+	// Fingerprint of the first request, a key reused with another payload is rejected
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+type IdempotencyStore interface {
+	// Reserve marks the key as in flight. When the key is already taken it returns false
+	// together with its stored response, or nil while the first request is still running
+	Reserve(ctx context.Context, key string, lockTTL time.Duration) (bool, *StoredResponse, error)
+	Save(ctx context.Context, key string, res StoredResponse, ttl time.Duration) error
+	// Release frees a reserved key whose response must not be replayed
+	Release(ctx context.Context, key string) error
+}
+
+type IdempotencyPolicy struct {
+	Store IdempotencyStore
+	// TTL is how long the responses are replayed, DefaultIdempotencyTTL when zero
+	TTL time.Duration
+	// LockTTL frees the keys of requests that never completed, DefaultIdempotencyLockTTL when zero
+	LockTTL time.Duration
+	// MaxBodyBytes is the largest body read to fingerprint the request, DefaultIdempotencyMaxBody when zero
+	MaxBodyBytes int64
+	// TrustedProxies is the number of proxies in front of the service, see RateLimitPolicy
+	TrustedProxies int
+}
+
+type IdempotencyConflictError struct {
+	Key string
+}
+
+func (e IdempotencyConflictError) Error() string {
+	return ErrorIdempotencyInFlight
+}
+
+func (e IdempotencyConflictError) Code() int {
+	return http.StatusConflict
+}
+
+// WithIdempotency replays the first response of the mutating requests sent with the same Idempotency-Key.
+// Only JSON responses can be replayed, the option is ignored by Forwarders of other response types
+func (f *Forwarder) WithIdempotency(p *IdempotencyPolicy) *Forwarder {
+	f.idempotency = p
+	return f
+}
+
+// idempotentEndpoint applies the idempotency policy inside the authorization, so that rejected callers never reach the store
+func (f *Forwarder) idempotentEndpoint(e endpoint.Endpoint) endpoint.Endpoint {
+	if !f.idempotent() {
+		return e
+	}
+
+	return f.idempotency.Wrap(e)
+}
+
+// idempotent tells if the policy applies, only JSON responses can be replayed
+func (f *Forwarder) idempotent() bool {
+	return f.idempotency != nil && (f.ApiResponseType == "" || f.ApiResponseType == ApiResponseTypeJson)
+}
+
+func (f *Forwarder) plugIdempotencyKey(ctx context.Context, req *http.Request) context.Context {
+	key := req.Header.Get(IdempotencyKeyHeader)
+	if key == "" || req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == http.MethodOptions {
+		return ctx
+	}
+
+	h := sha256.New()
+	h.Write([]byte(req.URL.RawQuery))
+	h.Write([]byte{0})
+	if req.Body != nil {
+		b, err := io.ReadAll(http.MaxBytesReader(nil, req.Body, f.idempotency.maxBodyBytes()))
+		_ = req.Body.Close()
+		if err != nil {
+			//The decoder fails with the same error
+			req.Body = io.NopCloser(io.MultiReader(bytes.NewReader(b), failingReader{err}))
+			return ctx
+		}
+		//The decoder reads the body again
+		req.Body = io.NopCloser(bytes.NewReader(b))
+		h.Write(b)
+	}
+
+	ctx = context.WithValue(ctx, IdempotencyCtxKey, key)
+	ctx = context.WithValue(ctx, IdempotencyClientCtxKey, clientIP(req, f.idempotency.TrustedProxies))
+
+	return context.WithValue(ctx, IdempotencyFingerprintCtxKey, hex.EncodeToString(h.Sum(nil)))
+}
+
+type failingReader struct {
+	err error
+}
+
+func (r failingReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// idempotencyStoreKey scopes the client key to the caller and the route, so that keys of different callers never collide.
+// Anonymous callers are told apart by their address
+func idempotencyStoreKey(ctx context.Context) string {
+	key, _ := ctx.Value(IdempotencyCtxKey).(string)
+	if key == "" {
+		return ""
+	}
+
+	caller := ""
+	if auth, ok := AuthorizationFromContext(ctx); ok && auth.Error == nil && auth.User != "" {
+		caller = "user:" + auth.User
+	} else if ip, _ := ctx.Value(IdempotencyClientCtxKey).(string); ip != "" {
+		caller = "ip:" + ip
+	}
+	method, _ := ctx.Value(kitHttp.ContextKeyRequestMethod).(string)
+	path, _ := ctx.Value(kitHttp.ContextKeyRequestPath).(string)
+
+	return caller + ":" + method + ":" + path + ":" + key
+}
+
+// Wrap returns an endpoint middleware enforcing the policy
+func (p *IdempotencyPolicy) Wrap(actual endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, req interface{}) (interface{}, error) {
+		key := idempotencyStoreKey(ctx)
+		if key == "" {
+			return actual(ctx, req)
+		}
+
+		reserved, stored, err := p.Store.Reserve(ctx, key, p.lockTTL())
+		if err != nil {
+			return nil, err
+		}
+		if !reserved {
+			if stored == nil {
+				return nil, IdempotencyConflictError{Key: key}
+			}
+			fp, _ := ctx.Value(IdempotencyFingerprintCtxKey).(string)
+			if stored.Fingerprint != fp {
+				return nil, InvalidRequestError{Err: errors.New(ErrorIdempotencyKeyReused)}
+			}
+			return stored.replay()
+		}
+
+		res, err := actual(ctx, req)
+
+		//The outcome is stored even when the client has gone away
+		storeCtx := context.WithoutCancel(ctx)
+		if s, ok := toStoredResponse(res, err); ok {
+			s.Fingerprint, _ = ctx.Value(IdempotencyFingerprintCtxKey).(string)
+			_ = p.Store.Save(storeCtx, key, s, p.ttl())
+		} else {
+			_ = p.Store.Release(storeCtx, key)
+		}
+
+		return res, err
+	}
+}
+
+func (p *IdempotencyPolicy) ttl() time.Duration {
+	if p.TTL > 0 {
+		return p.TTL
+	}
+	return DefaultIdempotencyTTL
+}
+
+func (p *IdempotencyPolicy) lockTTL() time.Duration {
+	if p.LockTTL > 0 {
+		return p.LockTTL
+	}
+	return DefaultIdempotencyLockTTL
+}
+
+func (p *IdempotencyPolicy) maxBodyBytes() int64 {
+	if p.MaxBodyBytes > 0 {
+		return p.MaxBodyBytes
+	}
+	return DefaultIdempotencyMaxBody
+}
+
+// toStoredResponse keeps the successful JSON responses, a failed request can be retried with the same key
+func toStoredResponse(res interface{}, err error) (StoredResponse, bool) {
+	if err != nil {
+		return StoredResponse{}, false
+	}
+
+	switch res.(type) {
+	case RedirectResponse, DownloadFile, StreamResponse:
+		return StoredResponse{}, false
+	}
+
+	b, mErr := json.Marshal(res)
+	if mErr != nil {
+		return StoredResponse{}, false
+	}
+
+	return StoredResponse{Status: http.StatusOK, Body: b}, true
+}
+
+func (s *StoredResponse) replay() (interface{}, error) {
+	if s.Status == http.StatusOK {
+		return s.Body, nil
+	}
+
+	env := ErrorEnvelope{}
+	if err := json.Unmarshal(s.Body, &env); err != nil {
+		return nil, err
+	}
+
+	return nil, RemoteError{
+		Status:  s.Status,
+		Key:     env.Key,
+		Message: env.Message,
+		Fields:  env.Details,
+	}
+}
+
+// MemoryIdempotencyStore keeps the responses in process, it does not protect from duplicates across replicas
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryIdempotencyEntry
+}
+
+type memoryIdempotencyEntry struct {
+	res       *StoredResponse
+	expiresAt time.Time
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		entries: make(map[string]memoryIdempotencyEntry),
+	}
+}
+
+func (m *MemoryIdempotencyStore) Reserve(_ context.Context, key string, lockTTL time.Duration) (bool, *StoredResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.entries[key]; ok && time.Now().Before(e.expiresAt) {
+		return false, e.res, nil
+	}
+	m.entries[key] = memoryIdempotencyEntry{expiresAt: time.Now().Add(lockTTL)}
+
+	return true, nil, nil
+}
+
+func (m *MemoryIdempotencyStore) Save(_ context.Context, key string, res StoredResponse, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries[key] = memoryIdempotencyEntry{res: &res, expiresAt: time.Now().Add(ttl)}
+
+	return nil
+}
+
+func (m *MemoryIdempotencyStore) Release(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+
+	return nil
+}
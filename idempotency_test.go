@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func idempotentCall(h http.Handler, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/subscriptions", nil)
+	req.Header.Set(IdempotencyKeyHeader, key)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotentRequestsAreReplayed(t *testing.T) {
+	var calls int32
+	e := func(context.Context, interface{}) (interface{}, error) {
+		n := atomic.AddInt32(&calls, 1)
+		if n > 1 {
+			return nil, InvalidRequestError{Err: errors.New(ErrorSubAlreadyExists)}
+		}
+		return map[string]int32{"id": n}, nil
+	}
+	dec := func(context.Context, *http.Request) (interface{}, error) {
+		return nil, nil
+	}
+	h := NewForwarder(nil).WithIdempotency(&IdempotencyPolicy{Store: NewMemoryIdempotencyStore()}).Forward(e, dec)
+
+	first := idempotentCall(h, "k1")
+	replay := idempotentCall(h, "k1")
+	assert.Equal(t, http.StatusOK, replay.Code)
+	assert.JSONEq(t, first.Body.String(), replay.Body.String())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	other := idempotentCall(h, "k2")
+	assert.Equal(t, http.StatusUnprocessableEntity, other.Code)
+	assert.Contains(t, idempotentCall(h, "k2").Body.String(), ErrorSubAlreadyExists)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls), "failures are not replayed")
+}
+
+type headerAuthorizer struct{}
+
+func (headerAuthorizer) Authorize(_ context.Context, req *http.Request) Authorization {
+	if user := req.Header.Get("Authorization"); user != "" {
+		return Authorization{User: user}
+	}
+	return Authorization{Error: errors.New("missing-token")}
+}
+
+func TestIdempotencyRunsAfterAuthorization(t *testing.T) {
+	var calls int32
+	e := func(context.Context, interface{}) (interface{}, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}
+	dec := func(context.Context, *http.Request) (interface{}, error) {
+		return nil, nil
+	}
+	h := NewForwarder(headerAuthorizer{}).WithIdempotency(&IdempotencyPolicy{Store: NewMemoryIdempotencyStore()}).SecureForward(e, dec)
+
+	call := func(user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/subscriptions", nil)
+		req.Header.Set(IdempotencyKeyHeader, "k")
+		if user != "" {
+			req.Header.Set("Authorization", user)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, call("").Code)
+	assert.Equal(t, "1", strings.TrimSpace(call("u1").Body.String()), "the rejected request is not stored")
+	assert.Equal(t, "2", strings.TrimSpace(call("u2").Body.String()))
+	assert.Equal(t, "1", strings.TrimSpace(call("u1").Body.String()))
+}
+
+func TestIdempotencyKeysOfAnonymousCallersAreScopedByAddress(t *testing.T) {
+	var calls int32
+	e := func(context.Context, interface{}) (interface{}, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}
+	dec := func(_ context.Context, req *http.Request) (interface{}, error) {
+		_, err := io.ReadAll(req.Body)
+		return nil, err
+	}
+	h := NewForwarder(nil).WithIdempotency(&IdempotencyPolicy{Store: NewMemoryIdempotencyStore(), MaxBodyBytes: 8}).Forward(e, dec)
+
+	call := func(addr, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/subscriptions", strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, "k")
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, "1", strings.TrimSpace(call("10.0.0.1:1234", "{}").Body.String()))
+	assert.Equal(t, "2", strings.TrimSpace(call("10.0.0.2:1234", "{}").Body.String()))
+	assert.Equal(t, "1", strings.TrimSpace(call("10.0.0.1:4321", "{}").Body.String()))
+
+	assert.NotEqual(t, http.StatusOK, call("10.0.0.3:1234", `{"plan":"too-long"}`).Code, "the body is limited")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestIdempotentRequestInFlightConflicts(t *testing.T) {
+	started := make(chan struct{})
+	done := make(chan struct{})
+	e := func(context.Context, interface{}) (interface{}, error) {
+		close(started)
+		<-done
+		return "ok", nil
+	}
+	dec := func(context.Context, *http.Request) (interface{}, error) {
+		return nil, nil
+	}
+	h := NewForwarder(nil).WithIdempotency(&IdempotencyPolicy{Store: NewMemoryIdempotencyStore()}).Forward(e, dec)
+
+	go idempotentCall(h, "k")
+	<-started
+	assert.Equal(t, http.StatusConflict, idempotentCall(h, "k").Code)
+	close(done)
+}
+
+func TestIdempotencyKeyReusedWithAnotherBody(t *testing.T) {
+	e := func(context.Context, interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	dec := func(_ context.Context, req *http.Request) (interface{}, error) {
+		b, err := io.ReadAll(req.Body)
+		return string(b), err
+	}
+	h := NewForwarder(nil).WithIdempotency(&IdempotencyPolicy{Store: NewMemoryIdempotencyStore()}).Forward(e, dec)
+
+	call := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/subscriptions", strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, "k")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, call(`{"plan":1}`).Code)
+	assert.Equal(t, http.StatusOK, call(`{"plan":1}`).Code)
+	reused := call(`{"plan":2}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, reused.Code)
+	assert.Contains(t, reused.Body.String(), ErrorIdempotencyKeyReused)
+}
@@ -65,3 +65,79 @@ func DummyMetric(n string) Metric {
 		RequestLatency: generic.NewHistogram(n+"_latency", 50),
 	}
 }
+
+type CircuitMetric struct {
+	State       metrics.Gauge
+	Transitions metrics.Counter
+	Rejected    metrics.Counter
+}
+
+func PrometheusCircuitMetric(ns, svc string) *CircuitMetric {
+	state := kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: ns,
+		Subsystem: svc,
+		Name:      "circuit_state",
+		Help:      "Circuit breaker state per target (0 closed, 1 open, 2 half-open).",
+	}, []string{"target"})
+
+	transitions := kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: ns,
+		Subsystem: svc,
+		Name:      "circuit_transitions_count",
+		Help:      "Number of circuit breaker state changes.",
+	}, []string{"target", "state"})
+
+	rejected := kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: ns,
+		Subsystem: svc,
+		Name:      "circuit_rejected_count",
+		Help:      "Number of calls rejected by the circuit breaker or the bulkhead.",
+	}, []string{"target", "reason"})
+
+	return &CircuitMetric{
+		State:       state,
+		Transitions: transitions,
+		Rejected:    rejected,
+	}
+}
+
+func DummyCircuitMetric(n string) *CircuitMetric {
+	return &CircuitMetric{
+		State:       generic.NewGauge(n + "_state"),
+		Transitions: generic.NewCounter(n + "_transitions"),
+		Rejected:    generic.NewCounter(n + "_rejected"),
+	}
+}
+
+type HealthMetric struct {
+	Status  metrics.Gauge
+	Latency metrics.Gauge
+}
+
+func PrometheusHealthMetric(ns, svc string) *HealthMetric {
+	status := kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: ns,
+		Subsystem: svc,
+		Name:      "health_check_status",
+		Help:      "Result of the last health check per dependency (1 up, 0 down).",
+	}, []string{"check", "critical"})
+
+	latency := kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: ns,
+		Subsystem: svc,
+		Name:      "health_check_latency_seconds",
+		Help:      "Duration of the last health check per dependency.",
+	}, []string{"check"})
+
+	return &HealthMetric{
+		Status:  status,
+		Latency: latency,
+	}
+}
+
+func DummyHealthMetric(n string) *HealthMetric {
+	return &HealthMetric{
+		Status:  generic.NewGauge(n + "_status"),
+		Latency: generic.NewGauge(n + "_latency"),
+	}
+}
@@ -0,0 +1,358 @@
+package utils
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	JWTAlgHS256 = "HS256"
+	JWTAlgRS256 = "RS256"
+
+	DefaultJWKSFetchTimeout = 10 * time.Second
+)
+
+type JWTClaims map[string]interface{}
+
+// JWKSource resolves the RSA public key of a token from its kid
+type JWKSource interface {
+	Key(ctx context.Context, kid string) (*rsa.PublicKey, error)
+}
+
+type JWTConfig struct {
+	// HMACSecret enables HS256 tokens
+	HMACSecret []byte
+	// Keys enables RS256 tokens
+	Keys     JWKSource
+	Issuer   string
+	Audience string
+	// Leeway is the clock skew tolerated on exp and nbf
+	Leeway time.Duration
+	// AllowNoExpiry accepts the tokens without exp, which never expire
+	AllowNoExpiry bool
+	// Claims maps validated claims to the Authorization, DefaultJWTClaimsMapping when nil
+	Claims func(JWTClaims) Authorization
+}
+
+type JWTAuthorizer struct {
+	cfg JWTConfig
+	now func() time.Time
+}
+
+func NewJWTAuthorizer(cfg JWTConfig) *JWTAuthorizer {
+	if cfg.Claims == nil {
+		cfg.Claims = DefaultJWTClaimsMapping
+	}
+
+	return &JWTAuthorizer{
+		cfg: cfg,
+		now: time.Now,
+	}
+}
+
+// DefaultJWTClaimsMapping takes the user from "sub" and the role from "role"
+func DefaultJWTClaimsMapping(c JWTClaims) Authorization {
+	auth := Authorization{}
+	switch sub := c["sub"].(type) {
+	case string:
+		auth.User = sub
+	case float64:
+		auth.User = fmt.Sprintf("%.0f", sub)
+	}
+	auth.Role, _ = c["role"].(string)
+
+	return auth
+}
+
+func (a *JWTAuthorizer) Authorize(ctx context.Context, req *http.Request) Authorization {
+	token := ExtractBearerToken(req)
+	if token == "" {
+		return Authorization{Error: errors.New(ErrorMissingToken)}
+	}
+
+	claims, err := a.Validate(ctx, token)
+	if err != nil {
+		return Authorization{Error: err}
+	}
+
+	return a.cfg.Claims(claims)
+}
+
+// Validate checks signature, expiration, issuer and audience of the token and returns its claims
+func (a *JWTAuthorizer) Validate(ctx context.Context, token string) (JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New(ErrorInvalidToken)
+	}
+
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, errors.New(ErrorInvalidToken)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New(ErrorInvalidToken)
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	digest := sha256.Sum256(signed)
+
+	//The algorithm is accepted only when its key is configured, to avoid HS/RS confusion
+	switch {
+	case header.Alg == JWTAlgHS256 && len(a.cfg.HMACSecret) > 0:
+		mac := hmac.New(sha256.New, a.cfg.HMACSecret)
+		mac.Write(signed)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return nil, errors.New(ErrorInvalidToken)
+		}
+	case header.Alg == JWTAlgRS256 && a.cfg.Keys != nil:
+		key, err := a.cfg.Keys.Key(ctx, header.Kid)
+		if err != nil {
+			return nil, errors.New(ErrorInvalidToken)
+		}
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+			return nil, errors.New(ErrorInvalidToken)
+		}
+	default:
+		return nil, errors.New(ErrorInvalidToken)
+	}
+
+	claims := JWTClaims{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, errors.New(ErrorInvalidToken)
+	}
+
+	return claims, a.checkClaims(claims)
+}
+
+func (a *JWTAuthorizer) checkClaims(c JWTClaims) error {
+	now := a.now()
+	exp, ok := c["exp"].(float64)
+	if !ok && !a.cfg.AllowNoExpiry {
+		return errors.New(ErrorInvalidToken)
+	}
+	if ok && now.After(time.Unix(int64(exp), 0).Add(a.cfg.Leeway)) {
+		return errors.New(ErrorExpiredToken)
+	}
+	if nbf, ok := c["nbf"].(float64); ok && now.Add(a.cfg.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New(ErrorInvalidToken)
+	}
+	if a.cfg.Issuer != "" && c["iss"] != a.cfg.Issuer {
+		return errors.New(ErrorInvalidToken)
+	}
+	if a.cfg.Audience != "" && !jwtHasAudience(c["aud"], a.cfg.Audience) {
+		return errors.New(ErrorInvalidToken)
+	}
+
+	return nil
+}
+
+func jwtHasAudience(aud interface{}, expected string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == expected
+	case []interface{}:
+		for _, a := range v {
+			if a == expected {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func decodeJWTPart(part string, dst interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, dst)
+}
+
+// JWKS is a static set of RSA keys
+type JWKS struct {
+	keys map[string]*rsa.PublicKey
+}
+
+func ParseJWKS(b []byte) (*JWKS, error) {
+	set := struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}{}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, err
+	}
+
+	ret := &JWKS{keys: make(map[string]*rsa.PublicKey)}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		ret.keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	return ret, nil
+}
+
+func LoadJWKSFile(path string) (*JWKS, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseJWKS(b)
+}
+
+func (s *JWKS) Key(_ context.Context, kid string) (*rsa.PublicKey, error) {
+	k, ok := s.keys[kid]
+	if !ok {
+		return nil, errors.New("unknown-jwk-" + kid)
+	}
+
+	return k, nil
+}
+
+// RemoteJWKS downloads the key set from an URL and refreshes it periodically or when an unknown kid shows up.
+// Concurrent refreshes share one download, bounded by DefaultJWKSFetchTimeout.
+type RemoteJWKS struct {
+	url        string
+	refresh    time.Duration
+	client     *http.Client
+	timeout    time.Duration
+	minRefresh time.Duration
+	group      singleflight.Group
+
+	mu        sync.RWMutex
+	set       *JWKS
+	fetchedAt time.Time
+}
+
+func NewRemoteJWKS(url string, refresh time.Duration) *RemoteJWKS {
+	return &RemoteJWKS{
+		url:        url,
+		refresh:    refresh,
+		client:     DefaultMicroserviceHttpClient,
+		timeout:    DefaultJWKSFetchTimeout,
+		minRefresh: 30 * time.Second,
+	}
+}
+
+func (r *RemoteJWKS) Key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	r.mu.RLock()
+	set, fetchedAt := r.set, r.fetchedAt
+	r.mu.RUnlock()
+
+	stale := set == nil || time.Since(fetchedAt) > r.refresh
+	if !stale {
+		if k, err := set.Key(ctx, kid); err == nil {
+			return k, nil
+		}
+		//Unknown kid: the keys may have been rotated, but do not hammer the issuer
+		stale = time.Since(fetchedAt) > r.minRefresh
+	}
+
+	if stale {
+		ch := r.group.DoChan("jwks", func() (interface{}, error) {
+			return r.refreshSet()
+		})
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case res := <-ch:
+			if res.Err != nil {
+				return nil, res.Err
+			}
+			set = res.Val.(*JWKS)
+		}
+	}
+
+	return set.Key(ctx, kid)
+}
+
+// refreshSet downloads the keys, on failure it keeps serving the last known ones
+func (r *RemoteJWKS) refreshSet() (*JWKS, error) {
+	//Not bound to the caller, the download is shared
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	set, err := r.fetch(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err != nil {
+		if r.set == nil {
+			return nil, err
+		}
+		r.fetchedAt = time.Now()
+		return r.set, nil
+	}
+	r.set = set
+	r.fetchedAt = time.Now()
+
+	return set, nil
+}
+
+func (r *RemoteJWKS) fetch(ctx context.Context) (*JWKS, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New("jwks-fetch-failed-" + res.Status)
+	}
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseJWKS(b)
+}
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func jwtPart(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signHS256(secret []byte, claims JWTClaims) string {
+	unsigned := jwtPart(map[string]string{"alg": JWTAlgHS256, "typ": "JWT"}) + "." + jwtPart(claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(key *rsa.PrivateKey, kid string, claims JWTClaims) string {
+	unsigned := jwtPart(map[string]string{"alg": JWTAlgRS256, "kid": kid}) + "." + jwtPart(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestJWTAuthorizer(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	jwks, err := ParseJWKS([]byte(fmt.Sprintf(`{"keys":[{"kty":"RSA","kid":"k1","use":"sig","n":"%s","e":"%s"}]}`,
+		base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	)))
+	assert.Nil(t, err)
+
+	secret := []byte("s3cret")
+	a := NewJWTAuthorizer(JWTConfig{HMACSecret: secret, Keys: jwks, Issuer: "4books"})
+	valid := JWTClaims{"sub": float64(42), "role": RoleCMS, "iss": "4books", "exp": float64(time.Now().Add(time.Hour).Unix())}
+
+	tests := []struct {
+		token string
+		err   string
+	}{
+		{signHS256(secret, valid), ""},
+		{signRS256(key, "k1", valid), ""},
+		{signRS256(key, "k2", valid), ErrorInvalidToken},
+		{signHS256([]byte("other"), valid), ErrorInvalidToken},
+		{jwtPart(map[string]string{"alg": "none"}) + "." + jwtPart(valid) + ".", ErrorInvalidToken},
+		{signHS256(secret, JWTClaims{"sub": "1", "iss": "4books", "exp": float64(time.Now().Add(-time.Hour).Unix())}), ErrorExpiredToken},
+		{signHS256(secret, JWTClaims{"sub": "1", "iss": "other"}), ErrorInvalidToken},
+		{signHS256(secret, JWTClaims{"sub": "42", "role": RoleCMS, "iss": "4books"}), ErrorInvalidToken},
+	}
+
+	for i, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		auth := a.Authorize(context.Background(), req)
+		if tt.err == "" {
+			assert.Nil(t, auth.Error, "case %d", i)
+			assert.Equal(t, Authorization{User: "42", Role: RoleCMS}, auth)
+		} else {
+			assert.EqualError(t, auth.Error, tt.err, "case %d", i)
+		}
+	}
+}
+
+func TestJWTAuthorizerNoExpiryOptIn(t *testing.T) {
+	secret := []byte("s3cret")
+	a := NewJWTAuthorizer(JWTConfig{HMACSecret: secret, AllowNoExpiry: true})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+signHS256(secret, JWTClaims{"sub": "42"}))
+	assert.Equal(t, Authorization{User: "42"}, a.Authorize(context.Background(), req))
+}
+
+func TestRemoteJWKSDoesNotBlockOnSlowIssuer(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		_, _ = w.Write([]byte(`{"keys":[]}`))
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	r := NewRemoteJWKS(srv.URL, time.Hour)
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		begin := time.Now()
+		_, err := r.Key(ctx, "k1")
+		cancel()
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(begin), time.Second)
+	}
+}
+
+func TestSecureForwardExposesAuthErrorKey(t *testing.T) {
+	e := func(ctx context.Context, request interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	dec := func(context.Context, *http.Request) (interface{}, error) {
+		return struct{}{}, nil
+	}
+	srv := httptest.NewServer(NewForwarder(NewJWTAuthorizer(JWTConfig{HMACSecret: []byte("x")})).SecureForward(e, dec))
+	defer srv.Close()
+
+	err := MicroserviceClient{Url: srv.URL}.Get("/", nil, nil)
+	var remote RemoteError
+	assert.True(t, errors.As(err, &remote))
+	assert.Equal(t, http.StatusUnauthorized, remote.Code())
+	assert.Equal(t, ErrorMissingToken, remote.ErrorKey())
+}
+
+func TestApiTokenAndChainAuthorizers(t *testing.T) {
+	tokens := NewApiTokenAuthorizer(
+		ApiToken{Token: "old", User: "svc"},
+		ApiToken{Token: "new", User: "svc"},
+	)
+	chain := NewChainAuthorizer(NewJWTAuthorizer(JWTConfig{HMACSecret: []byte("x")}), tokens)
+
+	for _, tk := range []string{"old", "new"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(AuthTokenHeaderName, tk)
+		assert.Equal(t, Authorization{User: "svc"}, chain.Authorize(context.Background(), req))
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(AuthTokenHeaderName, "wrong")
+	assert.EqualError(t, chain.Authorize(context.Background(), req).Error, ErrorInvalidToken)
+
+	req = httptest.NewRequest("GET", "/", nil)
+	assert.EqualError(t, chain.Authorize(context.Background(), req).Error, ErrorMissingToken)
+}
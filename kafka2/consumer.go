@@ -165,6 +165,15 @@ func (k *KafkaConsumer) Start() error {
 	return nil
 }
 
+// PingContext checks that at least one broker is reachable
+func (k *KafkaConsumer) PingContext(ctx context.Context) error {
+	if k.client == nil {
+		return errors.New("kafka-consumer-not-started")
+	}
+
+	return k.client.Ping(ctx)
+}
+
 func (k *KafkaConsumer) Stop() error {
 	k.client.CloseAllowingRebalance()
 	return nil
@@ -294,6 +303,7 @@ func (k *KafkaConsumer) consume() {
 				Partition: r.Partition,
 				Offset:    r.Offset,
 				Timestamp: r.Timestamp,
+				Headers:   r.Headers,
 			}
 			k.Ch <- kr
 			k.commitLock.Lock()
@@ -0,0 +1,30 @@
+package kafka2
+
+import (
+	"context"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/4books-sparta/utils/correlation"
+)
+
+// RecordHeaders returns the headers propagating the request id of the context
+func RecordHeaders(ctx context.Context) []kgo.RecordHeader {
+	id := correlation.FromContext(ctx)
+	if id == "" {
+		return nil
+	}
+
+	return []kgo.RecordHeader{{Key: correlation.MessageKey, Value: []byte(id)}}
+}
+
+// ContextFromRecord restores the request id sent by the producer
+func ContextFromRecord(ctx context.Context, r *KafkaRecord) context.Context {
+	for _, h := range r.Headers {
+		if h.Key == correlation.MessageKey && correlation.IsValid(string(h.Value)) {
+			return correlation.WithRequestID(ctx, string(h.Value))
+		}
+	}
+
+	return ctx
+}
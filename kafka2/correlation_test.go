@@ -0,0 +1,25 @@
+package kafka2
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/4books-sparta/utils/correlation"
+)
+
+func TestRequestIdIsPropagatedThroughHeaders(t *testing.T) {
+	assert.Nil(t, RecordHeaders(context.Background()))
+
+	rec := &kgo.Record{Topic: "books", Headers: RecordHeaders(correlation.WithRequestID(context.Background(), "abc-123"))}
+	startProducerSpan(context.Background(), rec).End()
+
+	ctx, span := StartConsumerSpan(context.Background(), (*KafkaRecord)(rec))
+	span.End()
+	assert.Equal(t, "abc-123", correlation.FromContext(ctx))
+
+	forged := &KafkaRecord{Headers: []kgo.RecordHeader{{Key: correlation.MessageKey, Value: []byte("abc\n123")}}}
+	assert.Empty(t, correlation.FromContext(ContextFromRecord(context.Background(), forged)))
+}
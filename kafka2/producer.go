@@ -17,8 +17,11 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/twmb/franz-go/pkg/kgo"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/4books-sparta/utils"
+	"github.com/4books-sparta/utils/correlation"
+	"github.com/4books-sparta/utils/tracing"
 )
 
 type KafkaProducer struct {
@@ -110,13 +113,22 @@ func KafkaProducerCreate(opts ...KafkaOption) (*KafkaProducer, error) {
 
 func (k *KafkaProducer) Ping() {
 	fmt.Println("PING")
-	err := k.client.Ping(context.Background())
+	err := k.PingContext(context.Background())
 	if err != nil {
 		fmt.Println("Error pinging", err)
 	}
 	fmt.Println("Pong")
 }
 
+// PingContext checks that at least one broker is reachable
+func (k *KafkaProducer) PingContext(ctx context.Context) error {
+	if k.client == nil {
+		return errors.New("kafka-producer-not-started")
+	}
+
+	return k.client.Ping(ctx)
+}
+
 func (k *KafkaProducer) Start(cb func(r *kgo.Record, err error)) error {
 	log.Printf("Starting kafka producer for topic '%s' to brokers %+v. Syncronous: %v Partitioner: %s Compression: %s SASL: %s ",
 		k.cfg.topic,
@@ -169,24 +181,34 @@ func (k *KafkaProducer) Stop() error {
 }
 
 func (k *KafkaProducer) Send(key []byte, value []byte) error {
+	return k.SendCtx(context.Background(), key, value)
+}
+
+// SendCtx sends the record with the request id of the context in its headers
+func (k *KafkaProducer) SendCtx(ctx context.Context, key []byte, value []byte) error {
 	rec := &kgo.Record{
 		Topic:     k.cfg.topic,
 		Key:       key,
 		Value:     value,
 		Timestamp: time.Now(),
+		Headers:   RecordHeaders(ctx),
 	}
+	span := startProducerSpan(ctx, rec)
 	if !k.cfg.syncProducer {
 		if k.Verbose {
 			fmt.Println("Producing async")
 		}
 		k.Ch <- rec
+		tracing.End(span, nil)
 		return nil
 	} else {
 		if k.Verbose {
 			fmt.Println("Producing sync")
 		}
 		res := k.client.ProduceSync(context.Background(), rec)
-		if err := res.FirstErr(); err != nil {
+		err := res.FirstErr()
+		tracing.End(span, err)
+		if err != nil {
 			log.Printf("Error producing")
 			return err
 		}
@@ -235,13 +257,20 @@ func StartNewProducer(brokers []string, topic string, authType string) *KafkaPro
 }
 
 func (k *KafkaProducer) SendMsg(msg interface{}, key string) error {
+	return k.SendMsgCtx(context.Background(), msg, key)
+}
+
+func (k *KafkaProducer) SendMsgCtx(ctx context.Context, msg interface{}, key string) error {
 	strJSON, err := json.Marshal(msg)
 	if err != nil {
 		fmt.Println("producer-send-marshal-error", err)
 		return err
 	}
+	//The record is sent after the caller returns, its context may be canceled by then
+	detached := correlation.WithRequestID(context.Background(), correlation.FromContext(ctx))
+	ctx = trace.ContextWithSpanContext(detached, trace.SpanContextFromContext(ctx))
 	go func() {
-		err := k.Send([]byte(key), strJSON)
+		err := k.SendCtx(ctx, []byte(key), strJSON)
 		if err != nil {
 			fmt.Println("producer-send-error", err)
 			return
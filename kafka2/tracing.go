@@ -0,0 +1,67 @@
+package kafka2
+
+import (
+	"context"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/4books-sparta/utils/tracing"
+)
+
+// headerCarrier adapts the record headers to the OpenTelemetry propagators
+type headerCarrier struct {
+	headers *[]kgo.RecordHeader
+}
+
+func (c headerCarrier) Get(key string) string {
+	for _, h := range *c.headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c headerCarrier) Set(key string, value string) {
+	for i, h := range *c.headers {
+		if h.Key == key {
+			(*c.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.headers = append(*c.headers, kgo.RecordHeader{Key: key, Value: []byte(value)})
+}
+
+func (c headerCarrier) Keys() []string {
+	ret := make([]string, 0, len(*c.headers))
+	for _, h := range *c.headers {
+		ret = append(ret, h.Key)
+	}
+	return ret
+}
+
+func startProducerSpan(ctx context.Context, rec *kgo.Record) trace.Span {
+	ctx, span := tracing.Start(ctx, rec.Topic+" publish", trace.SpanKindProducer,
+		attribute.String("messaging.system", "kafka"),
+		attribute.String("messaging.destination.name", rec.Topic),
+	)
+	tracing.Propagator().Inject(ctx, headerCarrier{headers: &rec.Headers})
+
+	return span
+}
+
+// StartConsumerSpan starts the processing span of a record, as child of the producer's span.
+// The caller must end the returned span once the record has been handled
+func StartConsumerSpan(ctx context.Context, r *KafkaRecord) (context.Context, trace.Span) {
+	ctx = ContextFromRecord(ctx, r)
+	ctx = tracing.Propagator().Extract(ctx, headerCarrier{headers: &r.Headers})
+
+	return tracing.Start(ctx, r.Topic+" process", trace.SpanKindConsumer,
+		attribute.String("messaging.system", "kafka"),
+		attribute.String("messaging.destination.name", r.Topic),
+		attribute.Int("messaging.destination.partition.id", int(r.Partition)),
+		attribute.Int64("messaging.kafka.offset", r.Offset),
+	)
+}
@@ -0,0 +1,34 @@
+package kafka2
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/twmb/franz-go/pkg/kgo"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/4books-sparta/utils/tracing"
+)
+
+func TestConsumerSpanContinuesProducerTrace(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracing.Enable(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)), nil)
+	defer tracing.Disable()
+
+	rec := &kgo.Record{Topic: "books"}
+	startProducerSpan(context.Background(), rec).End()
+
+	_, span := StartConsumerSpan(context.Background(), &KafkaRecord{Topic: rec.Topic, Headers: rec.Headers})
+	span.End()
+
+	spans := exporter.GetSpans()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+	assert.Equal(t, "books publish", spans[0].Name)
+	assert.Equal(t, "books process", spans[1].Name)
+	assert.Equal(t, spans[0].SpanContext.TraceID(), spans[1].SpanContext.TraceID())
+	assert.Equal(t, spans[0].SpanContext.SpanID(), spans[1].Parent.SpanID())
+}
@@ -4,7 +4,7 @@ import (
 	"errors"
 	"time"
 
-	"gopkg.in/go-playground/validator.v9"
+	"github.com/4books-sparta/utils"
 )
 
 const (
@@ -72,7 +72,7 @@ type BigqueryMsg struct {
 }
 
 func (msg *BigqueryMsg) Validate() error {
-	validate := validator.New()
+	validate := utils.Validator()
 
 	switch msg.Type {
 	case BigqueryTypeUserLocation:
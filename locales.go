@@ -1,5 +1,13 @@
 package utils
 
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"golang.org/x/text/language"
+)
+
 type Locale string
 
 func (l Locale) ToString() string {
@@ -11,29 +19,172 @@ const (
 	EsLocale      = Locale("es")
 	ItLocale      = Locale("it")
 	DefaultLocale = ItLocale
+
+	LocaleCtxKey      = "req-locale"
+	LocaleChainCtxKey = "req-locale-chain"
 )
 
-var supported = map[Locale]struct{}{
-	ItLocale: struct{}{},
-	EsLocale: struct{}{},
-	EnLocale: struct{}{},
+// LocalePolicy configures the negotiation of the Forwarder
+type LocalePolicy struct {
+	// Tenant picks the fallback chain of the request, see SetLocaleFallbacks
+	Tenant func(context.Context, *http.Request) string
+}
+
+var (
+	localesMu sync.RWMutex
+	// supported keeps the registration order, DefaultLocale first
+	supported       = []Locale{ItLocale, EsLocale, EnLocale}
+	localeMatcher   = newLocaleMatcher(supported)
+	localeFallbacks = map[string][]Locale{}
+)
+
+func newLocaleMatcher(ll []Locale) language.Matcher {
+	tags := make([]language.Tag, 0, len(ll))
+	for _, l := range ll {
+		tags = append(tags, language.Make(string(l)))
+	}
+
+	return language.NewMatcher(tags)
+}
+
+// RegisterLocale adds supported locales at runtime, e.g. when a service ships a new translation
+func RegisterLocale(ll ...Locale) error {
+	localesMu.Lock()
+	defer localesMu.Unlock()
+
+	for _, l := range ll {
+		if _, err := language.Parse(string(l)); err != nil {
+			return err
+		}
+		if !supportedLocale(l) {
+			supported = append(supported, l)
+		}
+	}
+	localeMatcher = newLocaleMatcher(supported)
+
+	return nil
+}
+
+// SetLocaleFallbacks sets the locales tried by a tenant after the negotiated ones, before DefaultLocale.
+// The empty tenant is used by the requests without one.
+func SetLocaleFallbacks(tenant string, chain ...Locale) {
+	localesMu.Lock()
+	defer localesMu.Unlock()
+
+	localeFallbacks[tenant] = chain
 }
 
 func SupportedLocale(l Locale) bool {
-	_, ok := supported[l]
+	localesMu.RLock()
+	defer localesMu.RUnlock()
 
-	return ok
+	return supportedLocale(l)
+}
+
+func supportedLocale(l Locale) bool {
+	for _, s := range supported {
+		if s == l {
+			return true
+		}
+	}
+
+	return false
 }
 
 func GetSupportedLocales() map[Locale]struct{} {
-	return supported
+	localesMu.RLock()
+	defer localesMu.RUnlock()
+
+	ret := make(map[Locale]struct{}, len(supported))
+	for _, l := range supported {
+		ret[l] = struct{}{}
+	}
+
+	return ret
 }
 
+// LocaleFromString matches a language tag, e.g. en-GB is en, or returns DefaultLocale
 func LocaleFromString(lang string) Locale {
-	ll := Locale(lang)
-	if SupportedLocale(ll) {
-		return ll
+	return LocaleChain(lang, "")[0]
+}
+
+// LocaleFromAcceptLanguage returns the preferred supported language of an Accept-Language header, or DefaultLocale
+func LocaleFromAcceptLanguage(h string) Locale {
+	return LocaleChain(h, "")[0]
+}
+
+// LocaleChain returns the supported locales accepted by the header, by q-value, followed by
+// the fallbacks of the tenant and by DefaultLocale. Regions are matched to their language, es-419 is es.
+func LocaleChain(acceptLanguage string, tenant string) []Locale {
+	tags, _, _ := language.ParseAcceptLanguage(acceptLanguage)
+
+	localesMu.RLock()
+	defer localesMu.RUnlock()
+
+	var chain []Locale
+	add := func(l Locale) {
+		for _, c := range chain {
+			if c == l {
+				return
+			}
+		}
+		chain = append(chain, l)
+	}
+
+	for _, t := range tags {
+		_, i, conf := localeMatcher.Match(t)
+		if conf != language.No {
+			add(supported[i])
+		}
+	}
+	for _, l := range localeFallbacks[tenant] {
+		if supportedLocale(l) {
+			add(l)
+		}
+	}
+	add(DefaultLocale)
+
+	return chain
+}
+
+func WithLocale(ctx context.Context, l Locale) context.Context {
+	return context.WithValue(ctx, LocaleCtxKey, l)
+}
+
+// LocaleFromContext returns the locale of the request, when it sent an Accept-Language header
+func LocaleFromContext(ctx context.Context) (Locale, bool) {
+	l, ok := ctx.Value(LocaleCtxKey).(Locale)
+
+	return l, ok
+}
+
+// LocaleChainFromContext returns the locales to try for the request, see LocaleChain
+func LocaleChainFromContext(ctx context.Context) []Locale {
+	if c, ok := ctx.Value(LocaleChainCtxKey).([]Locale); ok {
+		return c
+	}
+
+	return []Locale{DefaultLocale}
+}
+
+func (f *Forwarder) WithLocalePolicy(p *LocalePolicy) *Forwarder {
+	f.locale = p
+	return f
+}
+
+func (f *Forwarder) plugLocale(ctx context.Context, req *http.Request) context.Context {
+	tenant := ""
+	if f.locale != nil && f.locale.Tenant != nil {
+		tenant = f.locale.Tenant(ctx, req)
+	}
+
+	h := req.Header.Get("Accept-Language")
+	chain := LocaleChain(h, tenant)
+	ctx = context.WithValue(ctx, LocaleChainCtxKey, chain)
+	if h == "" && tenant == "" {
+		//Without preferences the validation details keep their untranslated form
+		return ctx
 	}
 
-	return DefaultLocale
+	return WithLocale(ctx, chain[0])
 }
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// restoreLocales puts back the supported locales and the fallbacks changed by a test
+func restoreLocales(t *testing.T) {
+	localesMu.RLock()
+	prevSupported := append([]Locale(nil), supported...)
+	prevFallbacks := make(map[string][]Locale, len(localeFallbacks))
+	for k, v := range localeFallbacks {
+		prevFallbacks[k] = v
+	}
+	localesMu.RUnlock()
+
+	t.Cleanup(func() {
+		localesMu.Lock()
+		defer localesMu.Unlock()
+
+		supported = prevSupported
+		localeMatcher = newLocaleMatcher(supported)
+		localeFallbacks = prevFallbacks
+	})
+}
+
+func TestLocaleNegotiation(t *testing.T) {
+	restoreLocales(t)
+
+	assert.Equal(t, EnLocale, LocaleFromString("en-GB"))
+	assert.Equal(t, EsLocale, LocaleFromString("es-419"))
+	assert.Equal(t, DefaultLocale, LocaleFromString("fr"))
+	assert.Equal(t, DefaultLocale, LocaleFromString(""))
+	assert.Equal(t, EsLocale, LocaleFromAcceptLanguage("fr-FR, en;q=0.5, es-MX;q=0.8"))
+	assert.Equal(t, []Locale{EsLocale, EnLocale, ItLocale}, LocaleChain("fr-FR, en;q=0.5, es-MX;q=0.8", ""))
+
+	SetLocaleFallbacks("acme", EnLocale)
+	assert.Equal(t, []Locale{EnLocale, ItLocale}, LocaleChain("fr", "acme"))
+
+	f := NewForwarder(nil).WithLocalePolicy(&LocalePolicy{Tenant: func(_ context.Context, _ *http.Request) string { return "acme" }})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Language", "de-CH, es-419;q=0.7")
+	ctx := f.plugLocale(context.Background(), req)
+	l, ok := LocaleFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, EsLocale, l)
+	assert.Equal(t, []Locale{EsLocale, EnLocale, ItLocale}, LocaleChainFromContext(ctx))
+
+	assert.Nil(t, RegisterLocale("de"))
+	assert.Equal(t, Locale("de"), LocaleFromString("de-AT"))
+}
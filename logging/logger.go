@@ -1,9 +1,12 @@
 package logging
 
 import (
+	"context"
 	"os"
 
 	"github.com/go-kit/kit/log"
+
+	"github.com/4books-sparta/utils/correlation"
 )
 
 type Logging struct {
@@ -15,6 +18,12 @@ type ErrorReporter interface {
 	Message(string, ...string)
 }
 
+// ContextReporter is implemented by the reporters tagging the events with the request id of the context
+type ContextReporter interface {
+	ReportCtx(context.Context, error, ...string)
+	MessageCtx(context.Context, string, ...string)
+}
+
 func NewLoggingReporter(logger log.Logger) ErrorReporter {
 	return &Logging{logger}
 }
@@ -37,6 +46,34 @@ func (l *Logging) Message(msg string, args ...string) {
 	_ = l.logger.Log(in...)
 }
 
+func (l *Logging) ReportCtx(ctx context.Context, err error, args ...string) {
+	(&Logging{WithContext(l.logger, ctx)}).Report(err, args...)
+}
+
+func (l *Logging) MessageCtx(ctx context.Context, msg string, args ...string) {
+	(&Logging{WithContext(l.logger, ctx)}).Message(msg, args...)
+}
+
+// ReportCtx reports err with the request id of the context, whatever the reporter
+func ReportCtx(ctx context.Context, rep ErrorReporter, err error, args ...string) {
+	if cr, ok := rep.(ContextReporter); ok {
+		cr.ReportCtx(ctx, err, args...)
+		return
+	}
+
+	ReporterWithContext(rep, ctx).Report(err, args...)
+}
+
+// MessageCtx sends msg with the request id of the context, whatever the reporter
+func MessageCtx(ctx context.Context, rep ErrorReporter, msg string, args ...string) {
+	if cr, ok := rep.(ContextReporter); ok {
+		cr.MessageCtx(ctx, msg, args...)
+		return
+	}
+
+	ReporterWithContext(rep, ctx).Message(msg, args...)
+}
+
 func NewLogger() log.Logger {
 	logger := log.NewLogfmtLogger(os.Stderr)
 	logger = log.With(logger, "ts", log.DefaultTimestampUTC)
@@ -44,3 +81,43 @@ func NewLogger() log.Logger {
 
 	return logger
 }
+
+// WithContext returns a logger adding the request id of the context to every line
+func WithContext(logger log.Logger, ctx context.Context) log.Logger {
+	id := correlation.FromContext(ctx)
+	if id == "" {
+		return logger
+	}
+
+	return log.With(logger, "request_id", id)
+}
+
+type contextReporter struct {
+	rep ErrorReporter
+	id  string
+}
+
+// ReporterWithContext tags every report with the request id of the context, it works for any ErrorReporter (e.g. Sentry)
+func ReporterWithContext(rep ErrorReporter, ctx context.Context) ErrorReporter {
+	id := correlation.FromContext(ctx)
+	if id == "" {
+		return rep
+	}
+
+	return &contextReporter{rep: rep, id: id}
+}
+
+func (r *contextReporter) Report(err error, args ...string) {
+	r.rep.Report(err, r.withId(args)...)
+}
+
+func (r *contextReporter) Message(msg string, args ...string) {
+	r.rep.Message(msg, r.withId(args)...)
+}
+
+func (r *contextReporter) withId(args []string) []string {
+	ret := make([]string, 0, len(args)+2)
+	ret = append(ret, args...)
+
+	return append(ret, "request_id", r.id)
+}
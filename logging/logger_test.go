@@ -0,0 +1,40 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/4books-sparta/utils/correlation"
+)
+
+type argsReporter struct {
+	args []string
+}
+
+func (r *argsReporter) Report(_ error, args ...string) {
+	r.args = args
+}
+
+func (r *argsReporter) Message(_ string, args ...string) {
+	r.args = args
+}
+
+func TestReportCtxAddsTheRequestId(t *testing.T) {
+	ctx := correlation.WithRequestID(context.Background(), "abc-123")
+
+	var buf bytes.Buffer
+	ReportCtx(ctx, NewLoggingReporter(log.NewLogfmtLogger(&buf)), errors.New("failed"))
+	assert.Equal(t, "request_id=abc-123 error=failed\n", buf.String())
+
+	rep := &argsReporter{}
+	MessageCtx(ctx, rep, "msg", "key", "k")
+	assert.Equal(t, []string{"key", "k", "request_id", "abc-123"}, rep.args)
+
+	MessageCtx(context.Background(), rep, "msg", "key", "k")
+	assert.Equal(t, []string{"key", "k"}, rep.args)
+}
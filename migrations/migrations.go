@@ -0,0 +1,352 @@
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/4books-sparta/utils"
+)
+
+const (
+	DefaultTable = "schema_migrations"
+
+	ErrorChecksumMismatch = "migration-checksum-mismatch"
+	ErrorMissingDown      = "migration-down-missing"
+	ErrorUnknownApplied   = "migration-applied-but-unknown"
+)
+
+// fileName matches "<version>_<name>.up.sql" and "<version>_<name>.down.sql"
+var fileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version  uint64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type MigrationStatus struct {
+	Version   uint64     `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	// Modified is set when the file changed after being applied
+	Modified bool `json:"modified"`
+}
+
+type ChecksumError struct {
+	Version uint64
+}
+
+func (e ChecksumError) Error() string {
+	return ErrorChecksumMismatch + "-" + strconv.FormatUint(e.Version, 10)
+}
+
+type Migrator struct {
+	db         *utils.SqlDatabase
+	table      string
+	lockID     int64
+	migrations []Migration
+}
+
+type Option func(*Migrator)
+
+// Table sets the table tracking the applied versions, DefaultTable by default
+func Table(t string) Option {
+	return func(m *Migrator) {
+		m.table = t
+	}
+}
+
+// LockID sets the advisory lock key, by default it is derived from the table name
+func LockID(id int64) Option {
+	return func(m *Migrator) {
+		m.lockID = id
+	}
+}
+
+// New reads the migrations in dir of fsys, usually an embed.FS
+func New(db *utils.SqlDatabase, fsys fs.FS, dir string, opts ...Option) (*Migrator, error) {
+	m := &Migrator{
+		db:    db,
+		table: DefaultTable,
+	}
+	for _, o := range opts {
+		o(m)
+	}
+	if m.lockID == 0 {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte("migrations:" + m.table))
+		m.lockID = int64(h.Sum64())
+	}
+
+	var err error
+	m.migrations, err = Load(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Load parses the migration files of dir sorted by version
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[uint64]*Migration)
+	for _, e := range entries {
+		match := fileName.FindStringSubmatch(e.Name())
+		if e.IsDir() || match == nil {
+			continue
+		}
+
+		v, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[v]
+		if !ok {
+			mig = &Migration{Version: v, Name: match[2]}
+			byVersion[v] = mig
+		}
+		if mig.Name != match[2] {
+			return nil, fmt.Errorf("migration-version-%d-used-twice", v)
+		}
+		if match[3] == "up" {
+			mig.Up = string(b)
+			sum := sha256.Sum256(b)
+			mig.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mig.Down = string(b)
+		}
+	}
+
+	ret := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration-up-missing-%d", mig.Version)
+		}
+		ret = append(ret, *mig)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Version < ret[j].Version
+	})
+
+	return ret, nil
+}
+
+type appliedRow struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+// Migrate applies the pending migrations in order, each one in its own transaction
+func (m *Migrator) Migrate(ctx context.Context) error {
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if a, ok := applied[mig.Version]; ok {
+				if a.checksum != mig.Checksum {
+					return ChecksumError{Version: mig.Version}
+				}
+				continue
+			}
+
+			err := inTx(ctx, conn, func(tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, mig.Up); err != nil {
+					return fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+				}
+				_, err := tx.ExecContext(ctx, "INSERT INTO "+m.table+" (version, name, checksum) VALUES ($1, $2, $3)",
+					mig.Version, mig.Name, mig.Checksum)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Rollback reverts the last n applied migrations
+func (m *Migrator) Rollback(ctx context.Context, n int) error {
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		known := make(map[uint64]Migration, len(m.migrations))
+		for _, mig := range m.migrations {
+			known[mig.Version] = mig
+		}
+
+		versions := make([]uint64, 0, len(applied))
+		for v := range applied {
+			versions = append(versions, v)
+		}
+		sort.Slice(versions, func(i, j int) bool {
+			return versions[i] > versions[j]
+		})
+
+		for i := 0; i < n && i < len(versions); i++ {
+			mig, ok := known[versions[i]]
+			if !ok {
+				return errors.New(ErrorUnknownApplied + "-" + strconv.FormatUint(versions[i], 10))
+			}
+			if mig.Down == "" {
+				return errors.New(ErrorMissingDown + "-" + strconv.FormatUint(mig.Version, 10))
+			}
+
+			err := inTx(ctx, conn, func(tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, mig.Down); err != nil {
+					return fmt.Errorf("rollback %d_%s: %w", mig.Version, mig.Name, err)
+				}
+				_, err := tx.ExecContext(ctx, "DELETE FROM "+m.table+" WHERE version = $1", mig.Version)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Status lists the known migrations together with the applied ones
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var ret []MigrationStatus
+	err := m.withConn(ctx, func(conn *sql.Conn) error {
+		if err := m.ensureTable(ctx, conn); err != nil {
+			return err
+		}
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		ret = make([]MigrationStatus, 0, len(m.migrations))
+		for _, mig := range m.migrations {
+			st := MigrationStatus{Version: mig.Version, Name: mig.Name}
+			if a, ok := applied[mig.Version]; ok {
+				at := a.appliedAt
+				st.Applied = true
+				st.AppliedAt = &at
+				st.Modified = a.checksum != mig.Checksum
+			}
+			ret = append(ret, st)
+		}
+
+		return nil
+	})
+
+	return ret, err
+}
+
+func (m *Migrator) withConn(ctx context.Context, fn func(*sql.Conn) error) error {
+	sqlDB, err := m.db.DB.DB()
+	if err != nil {
+		return err
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	return fn(conn)
+}
+
+// locked runs fn holding the advisory lock, the lock belongs to the session so a single connection is used
+func (m *Migrator) locked(ctx context.Context, fn func(*sql.Conn) error) error {
+	return m.withConn(ctx, func(conn *sql.Conn) error {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", m.lockID); err != nil {
+			return err
+		}
+		defer func() {
+			_, _ = conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", m.lockID)
+		}()
+
+		if err := m.ensureTable(ctx, conn); err != nil {
+			return err
+		}
+
+		return fn(conn)
+	})
+}
+
+func (m *Migrator) ensureTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+m.table+` (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+
+	return err
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[uint64]appliedRow, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, checksum, applied_at FROM "+m.table)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	ret := make(map[uint64]appliedRow)
+	for rows.Next() {
+		var v uint64
+		var a appliedRow
+		if err := rows.Scan(&v, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		ret[v] = a
+	}
+
+	return ret, rows.Err()
+}
+
+func inTx(ctx context.Context, conn *sql.Conn, fn func(*sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,231 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/4books-sparta/utils"
+)
+
+func TestLoadSortsAndPairsFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sql/0002_add_isbn.up.sql":     {Data: []byte("ALTER TABLE books ADD isbn TEXT;")},
+		"sql/0002_add_isbn.down.sql":   {Data: []byte("ALTER TABLE books DROP isbn;")},
+		"sql/0001_create_books.up.sql": {Data: []byte("CREATE TABLE books (id SERIAL);")},
+		"sql/README.md":                {Data: []byte("ignored")},
+	}
+
+	ms, err := Load(fsys, "sql")
+	assert.Nil(t, err)
+	if !assert.Len(t, ms, 2) {
+		return
+	}
+	assert.Equal(t, uint64(1), ms[0].Version)
+	assert.Equal(t, "create_books", ms[0].Name)
+	assert.Empty(t, ms[0].Down)
+	assert.Equal(t, "ALTER TABLE books DROP isbn;", ms[1].Down)
+	assert.Len(t, ms[1].Checksum, 64)
+
+	fsys["sql/0003_orphan.down.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	_, err = Load(fsys, "sql")
+	assert.NotNil(t, err)
+}
+
+// recordingDriver logs the first two words of the statements, the queries return the applied rows
+type recordingDriver struct {
+	mu      sync.Mutex
+	stmts   []string
+	applied [][]driver.Value
+	// failing statements start with it
+	failing string
+}
+
+func (d *recordingDriver) Open(string) (driver.Conn, error) {
+	return &recordingConn{d: d}, nil
+}
+
+func (d *recordingDriver) log(s string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stmts = append(d.stmts, s)
+	if d.failing != "" && strings.HasPrefix(s, d.failing) {
+		return errors.New("failed")
+	}
+	return nil
+}
+
+func (d *recordingDriver) statements() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.stmts...)
+}
+
+type recordingConn struct {
+	d *recordingDriver
+}
+
+func (c *recordingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *recordingConn) Close() error {
+	return nil
+}
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	return c, c.d.log("BEGIN")
+}
+
+func (c *recordingConn) Commit() error {
+	return c.d.log("COMMIT")
+}
+
+func (c *recordingConn) Rollback() error {
+	return c.d.log("ROLLBACK")
+}
+
+func (c *recordingConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(0), c.d.log(strings.Join(strings.Fields(query)[:2], " "))
+}
+
+func (c *recordingConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	if err := c.d.log(strings.Join(strings.Fields(query)[:2], " ")); err != nil {
+		return nil, err
+	}
+
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	return &appliedRows{values: append([][]driver.Value(nil), c.d.applied...)}, nil
+}
+
+type appliedRows struct {
+	values [][]driver.Value
+}
+
+func (r *appliedRows) Columns() []string {
+	return []string{"version", "checksum", "applied_at"}
+}
+
+func (r *appliedRows) Close() error {
+	return nil
+}
+
+func (r *appliedRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+var recordingDrivers sync.Map
+
+func newRecordingMigrator(t *testing.T) (*Migrator, *recordingDriver) {
+	d := &recordingDriver{}
+	name := fmt.Sprintf("recording-%s-%p", t.Name(), d)
+	if _, loaded := recordingDrivers.LoadOrStore(name, d); !loaded {
+		sql.Register(name, d)
+	}
+	conn, err := sql.Open(name, "")
+	assert.Nil(t, err)
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{SkipDefaultTransaction: true})
+	assert.Nil(t, err)
+
+	fsys := fstest.MapFS{
+		"sql/0001_create_books.up.sql":   {Data: []byte("CREATE SEQUENCE books_seq;")},
+		"sql/0001_create_books.down.sql": {Data: []byte("DROP SEQUENCE books_seq;")},
+		"sql/0002_add_isbn.up.sql":       {Data: []byte("ALTER TABLE books ADD isbn TEXT;")},
+		"sql/0002_add_isbn.down.sql":     {Data: []byte("ALTER TABLE books DROP isbn;")},
+	}
+	m, err := New(&utils.SqlDatabase{DB: db}, fsys, "sql")
+	assert.Nil(t, err)
+
+	return m, d
+}
+
+func appliedValues(m *Migrator, i int) []driver.Value {
+	mig := m.migrations[i]
+	return []driver.Value{int64(mig.Version), mig.Checksum, time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC)}
+}
+
+func TestMigrateAppliesThePendingMigrationsUnderLock(t *testing.T) {
+	m, d := newRecordingMigrator(t)
+	d.applied = [][]driver.Value{appliedValues(m, 0)}
+
+	assert.Nil(t, m.Migrate(context.Background()))
+	assert.Equal(t, []string{
+		"SELECT pg_advisory_lock($1)",
+		"CREATE TABLE",
+		"SELECT version,",
+		"BEGIN", "ALTER TABLE", "INSERT INTO", "COMMIT",
+		"SELECT pg_advisory_unlock($1)",
+	}, d.statements())
+}
+
+func TestMigrateReleasesTheLockOnFailure(t *testing.T) {
+	m, d := newRecordingMigrator(t)
+	d.failing = "ALTER TABLE"
+
+	assert.NotNil(t, m.Migrate(context.Background()))
+	assert.Equal(t, []string{
+		"SELECT pg_advisory_lock($1)",
+		"CREATE TABLE",
+		"SELECT version,",
+		"BEGIN", "CREATE SEQUENCE", "INSERT INTO", "COMMIT",
+		"BEGIN", "ALTER TABLE", "ROLLBACK",
+		"SELECT pg_advisory_unlock($1)",
+	}, d.statements())
+
+	m, d = newRecordingMigrator(t)
+	modified := appliedValues(m, 0)
+	modified[1] = "changed"
+	d.applied = [][]driver.Value{modified}
+	assert.Equal(t, ChecksumError{Version: 1}, m.Migrate(context.Background()))
+	assert.Equal(t, "SELECT pg_advisory_unlock($1)", d.statements()[len(d.statements())-1])
+}
+
+func TestRollbackRevertsTheLastMigrations(t *testing.T) {
+	m, d := newRecordingMigrator(t)
+	d.applied = [][]driver.Value{appliedValues(m, 0), appliedValues(m, 1)}
+
+	assert.Nil(t, m.Rollback(context.Background(), 1))
+	assert.Equal(t, []string{
+		"SELECT pg_advisory_lock($1)",
+		"CREATE TABLE",
+		"SELECT version,",
+		"BEGIN", "ALTER TABLE", "DELETE FROM", "COMMIT",
+		"SELECT pg_advisory_unlock($1)",
+	}, d.statements())
+}
+
+func TestStatusReportsAppliedAndModifiedMigrations(t *testing.T) {
+	m, d := newRecordingMigrator(t)
+	modified := appliedValues(m, 1)
+	modified[1] = "changed"
+	d.applied = [][]driver.Value{modified}
+
+	st, err := m.Status(context.Background())
+	assert.Nil(t, err)
+	if !assert.Len(t, st, 2) {
+		return
+	}
+	assert.False(t, st[0].Applied)
+	assert.True(t, st[1].Applied)
+	assert.True(t, st[1].Modified)
+	assert.Equal(t, []string{"CREATE TABLE", "SELECT version,"}, d.statements(), "reading the status takes no lock")
+}
@@ -0,0 +1,392 @@
+package utils
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"iter"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	kitHttp "github.com/go-kit/kit/transport/http"
+	"github.com/google/uuid"
+)
+
+const (
+	ApiResponseTypeNdjson = ApiResponseType("application/x-ndjson")
+	// ApiResponseTypeNegotiated picks the encoding from the Accept header of each request
+	ApiResponseTypeNegotiated = ApiResponseType("negotiated")
+
+	streamFlushEvery = 100
+)
+
+// NegotiableResponseTypes are the encodings offered by ApiResponseTypeNegotiated, the first one is the default
+var NegotiableResponseTypes = []ApiResponseType{
+	ApiResponseTypeJson,
+	ApiResponseTypeNdjson,
+	ApiResponseTypeCsv,
+	ApiResponseTypeXml,
+}
+
+type NotAcceptableError struct {
+	Accept string
+}
+
+func (e NotAcceptableError) Error() string {
+	return "not-acceptable-response-type"
+}
+
+func (e NotAcceptableError) Code() int {
+	return http.StatusNotAcceptable
+}
+
+// StreamResponse is written while its items are produced, without buffering the whole response
+type StreamResponse struct {
+	Filename string
+	// Items yields the elements of the response, an error stops the stream
+	Items iter.Seq2[interface{}, error]
+	// CsvHeader is written as first CSV record
+	CsvHeader []string
+	// CsvRow converts an item to a CSV record, when nil items must be []string
+	CsvRow func(interface{}) []string
+	// XmlRoot is the element wrapping XML items, "items" when empty
+	XmlRoot string
+}
+
+func StreamFromSeq[T any](seq iter.Seq[T]) iter.Seq2[interface{}, error] {
+	return func(yield func(interface{}, error) bool) {
+		for v := range seq {
+			if !yield(v, nil) {
+				return
+			}
+		}
+	}
+}
+
+func StreamFromChan[T any](ch <-chan T) iter.Seq2[interface{}, error] {
+	return func(yield func(interface{}, error) bool) {
+		for v := range ch {
+			if !yield(v, nil) {
+				return
+			}
+		}
+	}
+}
+
+func StreamFromSlice[T any](items []T) iter.Seq2[interface{}, error] {
+	return func(yield func(interface{}, error) bool) {
+		for _, v := range items {
+			if !yield(v, nil) {
+				return
+			}
+		}
+	}
+}
+
+// NegotiateResponseType returns the offer with the highest quality in the Accept header.
+// Each offer takes the quality of its most specific media range, so "application/json;q=0, */*" refuses JSON
+func NegotiateResponseType(accept string, offers []ApiResponseType) (ApiResponseType, bool) {
+	if len(offers) == 0 {
+		return "", false
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+
+	type mediaRange struct {
+		mt string
+		q  float64
+	}
+	ranges := make([]mediaRange, 0)
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			if v, err := strconv.ParseFloat(qs, 64); err == nil {
+				q = v
+			}
+		}
+		ranges = append(ranges, mediaRange{mt: mt, q: q})
+	}
+
+	best, bestQ, bestRange := ApiResponseType(""), 0.0, len(ranges)
+	for _, o := range offers {
+		q, at, specificity := 0.0, -1, -1
+		for i, r := range ranges {
+			if s := mediaTypeSpecificity(r.mt, string(o)); s > specificity {
+				q, at, specificity = r.q, i, s
+			}
+		}
+		//On equal quality the client order wins, then the order of the offers
+		if q > bestQ || q == bestQ && q > 0 && at < bestRange {
+			best, bestQ, bestRange = o, q, at
+		}
+	}
+
+	return best, bestQ > 0
+}
+
+// mediaTypeSpecificity is -1 when the pattern does not match mt, otherwise higher for narrower patterns
+func mediaTypeSpecificity(pattern, mt string) int {
+	switch {
+	case pattern == mt:
+		return 2
+	case pattern == "*/*":
+		return 0
+	case strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mt, strings.TrimSuffix(pattern, "*")):
+		return 1
+	}
+
+	return -1
+}
+
+func negotiatedEncodedResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	accept, _ := ctx.Value(kitHttp.ContextKeyRequestAccept).(string)
+	rt, ok := NegotiateResponseType(accept, NegotiableResponseTypes)
+	if !ok {
+		return NotAcceptableError{Accept: accept}
+	}
+
+	w.Header().Add("Vary", "Accept")
+	switch rt {
+	case ApiResponseTypeNdjson:
+		return ndjsonEncodedResponse(ctx, w, response)
+	case ApiResponseTypeCsv:
+		return csvEncodedResponse(ctx, w, response)
+	case ApiResponseTypeXml:
+		if _, ok := response.(DownloadFile); ok {
+			return xmlEncodedResponse(ctx, w, response)
+		}
+		return xmlMarshalledResponse(ctx, w, response)
+	}
+
+	return encodeResponse(ctx, w, response)
+}
+
+func ndjsonEncodedResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", string(ApiResponseTypeNdjson))
+
+	if s, ok := response.(StreamResponse); ok {
+		return encodeStream(w, s, streamNdjson)
+	}
+
+	enc := json.NewEncoder(w)
+	rv := reflect.ValueOf(response)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return enc.Encode(response)
+	}
+	for i := 0; i < rv.Len(); i++ {
+		if err := enc.Encode(rv.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// xmlItems wraps the slices, an XML document has a single root
+type xmlItems struct {
+	XMLName xml.Name    `xml:"items"`
+	Items   interface{} `xml:"item"`
+}
+
+func xmlMarshalledResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	if s, ok := response.(StreamResponse); ok {
+		return encodeStream(w, s, streamXml)
+	}
+
+	rv := reflect.ValueOf(response)
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		response = xmlItems{Items: response}
+	}
+	//Marshalled before the status is sent, e.g. maps fail and must reach the error encoder
+	b, err := xml.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", string(ApiResponseTypeXml))
+	_, _ = w.Write([]byte(xml.Header))
+	_, err = w.Write(b)
+	return err
+}
+
+// streamWriter tells if the body of a stream has been started
+type streamWriter struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (w *streamWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *streamWriter) Flush() {
+	flush(w.ResponseWriter)
+}
+
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *streamWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// encodeStream writes the stream with enc. An error before the body is written goes to the error encoder,
+// afterwards the status is gone and an envelope would corrupt the body: the connection is aborted,
+// so that the client sees a truncated response instead of a well formed partial one.
+func encodeStream(w http.ResponseWriter, s StreamResponse, enc func(http.ResponseWriter, StreamResponse) error) error {
+	sw := &streamWriter{ResponseWriter: w}
+	err := enc(sw, s)
+	if err != nil && sw.wrote {
+		panic(http.ErrAbortHandler)
+	}
+	if err != nil {
+		w.Header().Del("Content-Disposition")
+	}
+
+	return err
+}
+
+func streamNdjson(w http.ResponseWriter, s StreamResponse) error {
+	w.Header().Set("Content-Type", string(ApiResponseTypeNdjson))
+
+	enc := json.NewEncoder(w)
+	return writeStream(w, s, func(item interface{}) error {
+		return enc.Encode(item)
+	})
+}
+
+func streamJson(w http.ResponseWriter, s StreamResponse) error {
+	w.Header().Set("Content-Type", string(ApiResponseTypeJson))
+	_, _ = w.Write([]byte("["))
+
+	first := true
+	err := writeStream(w, s, func(item interface{}) error {
+		b, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		if !first {
+			_, _ = w.Write([]byte(","))
+		}
+		first = false
+		_, err = w.Write(b)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write([]byte("]\n"))
+	return err
+}
+
+type xmlRow struct {
+	XMLName xml.Name `xml:"row"`
+	Cells   []string `xml:"cell"`
+}
+
+func streamXml(w http.ResponseWriter, s StreamResponse) error {
+	root := s.XmlRoot
+	if root == "" {
+		root = "items"
+	}
+
+	w.Header().Set("Content-Type", string(ApiResponseTypeXml))
+	if s.Filename != "" {
+		w.Header().Set("Content-Disposition", "attachment;filename="+s.Filename)
+	}
+	_, _ = w.Write([]byte(xml.Header + "<" + root + ">"))
+
+	enc := xml.NewEncoder(w)
+	err := writeStream(w, s, func(item interface{}) error {
+		if cells, ok := item.([]string); ok {
+			item = xmlRow{Cells: cells}
+		}
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+		return enc.Flush()
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write([]byte("</" + root + ">"))
+	return err
+}
+
+func streamCsv(w http.ResponseWriter, s StreamResponse) error {
+	fn := s.Filename
+	if fn == "" {
+		fn = "dl_" + uuid.New().String() + ".csv"
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", "attachment;filename="+fn)
+
+	wr := csv.NewWriter(w)
+	if len(s.CsvHeader) > 0 {
+		if err := wr.Write(s.CsvHeader); err != nil {
+			return err
+		}
+	}
+
+	err := writeStream(w, s, func(item interface{}) error {
+		var row []string
+		if s.CsvRow != nil {
+			row = s.CsvRow(item)
+		} else if r, ok := item.([]string); ok {
+			row = r
+		} else {
+			return errors.New("csv-stream-item-is-not-a-[]string")
+		}
+		return wr.Write(row)
+	}, wr.Flush)
+	if err != nil {
+		return err
+	}
+
+	wr.Flush()
+	return wr.Error()
+}
+
+// writeStream writes every item flushing the response periodically, before flushing the optional buffers are emptied
+func writeStream(w http.ResponseWriter, s StreamResponse, write func(interface{}) error, buffers ...func()) error {
+	if s.Items == nil {
+		return nil
+	}
+
+	flusher, _ := w.(http.Flusher)
+	n := 0
+	for item, err := range s.Items {
+		if err != nil {
+			return err
+		}
+		if err := write(item); err != nil {
+			return err
+		}
+
+		n++
+		if n%streamFlushEvery == 0 && flusher != nil {
+			for _, b := range buffers {
+				b()
+			}
+			flusher.Flush()
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"iter"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateResponseType(t *testing.T) {
+	rt, ok := NegotiateResponseType("", NegotiableResponseTypes)
+	assert.True(t, ok)
+	assert.Equal(t, ApiResponseTypeJson, rt)
+
+	rt, _ = NegotiateResponseType("text/html, text/*;q=0.8, application/json;q=0.5", NegotiableResponseTypes)
+	assert.Equal(t, ApiResponseTypeCsv, rt)
+
+	rt, _ = NegotiateResponseType("application/xml;q=0.9, application/x-ndjson", NegotiableResponseTypes)
+	assert.Equal(t, ApiResponseTypeNdjson, rt)
+
+	_, ok = NegotiateResponseType("image/png", NegotiableResponseTypes)
+	assert.False(t, ok)
+
+	rt, _ = NegotiateResponseType("application/json;q=0, */*", NegotiableResponseTypes)
+	assert.Equal(t, ApiResponseTypeNdjson, rt, "an explicit q=0 beats */*")
+	_, ok = NegotiateResponseType("*/*;q=0", NegotiableResponseTypes)
+	assert.False(t, ok)
+}
+
+func TestNegotiatedXml(t *testing.T) {
+	responses := map[string]interface{}{
+		"/books": []testBook{{Id: 1, Title: "Book"}},
+		"/map":   map[string]int{"a": 1},
+	}
+	e := func(ctx context.Context, request interface{}) (interface{}, error) {
+		return responses[request.(string)], nil
+	}
+	dec := func(_ context.Context, r *http.Request) (interface{}, error) {
+		return r.URL.Path, nil
+	}
+	h := NewForwarderWithResponseType(nil, ApiResponseTypeNegotiated).Forward(e, dec)
+
+	call := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", "application/xml")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := call("/books")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "<items><item><Id>1</Id><Title>Book</Title></item></items>")
+
+	w = call("/map")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.NotContains(t, w.Body.String(), "<?xml", "nothing is written before the document is marshalled")
+}
+
+func TestNegotiatedStream(t *testing.T) {
+	rows := make(chan []string)
+	go func() {
+		defer close(rows)
+		rows <- []string{"1", "a"}
+		rows <- []string{"2", "b"}
+	}()
+
+	e := func(ctx context.Context, request interface{}) (interface{}, error) {
+		return StreamResponse{
+			Filename:  "export.csv",
+			Items:     StreamFromChan(rows),
+			CsvHeader: []string{"id", "name"},
+		}, nil
+	}
+	dec := func(context.Context, *http.Request) (interface{}, error) {
+		return nil, nil
+	}
+	srv := httptest.NewServer(NewForwarderWithResponseType(nil, ApiResponseTypeNegotiated).Forward(e, dec))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Accept", "text/csv")
+	res, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "text/csv", res.Header.Get("Content-Type"))
+	assert.Equal(t, "id,name\n1,a\n2,b\n", string(body))
+}
+
+func streamServer(rt ApiResponseType, items iter.Seq2[interface{}, error]) *httptest.Server {
+	e := func(ctx context.Context, request interface{}) (interface{}, error) {
+		return StreamResponse{Items: items}, nil
+	}
+	dec := func(context.Context, *http.Request) (interface{}, error) {
+		return nil, nil
+	}
+
+	return httptest.NewServer(NewForwarderWithResponseType(nil, rt).Forward(e, dec))
+}
+
+func failingAfter(n int) iter.Seq2[interface{}, error] {
+	return func(yield func(interface{}, error) bool) {
+		for i := 0; i < n; i++ {
+			if !yield(i, nil) {
+				return
+			}
+		}
+		yield(nil, errors.New(ErrorResourceNotFound))
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	srv := streamServer(ApiResponseTypeJson, StreamFromSlice([]int{1, 2}))
+	res, err := http.Get(srv.URL)
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	srv.Close()
+	assert.Equal(t, "[1,2]\n", string(body))
+
+	srv = streamServer(ApiResponseTypeNdjson, failingAfter(0))
+	res, err = http.Get(srv.URL)
+	assert.Nil(t, err)
+	env := ErrorEnvelope{}
+	assert.Nil(t, json.NewDecoder(res.Body).Decode(&env))
+	_ = res.Body.Close()
+	srv.Close()
+	assert.Equal(t, ErrorResourceNotFound, env.Key)
+
+	srv = streamServer(ApiResponseTypeNdjson, failingAfter(250))
+	defer srv.Close()
+	res, err = http.Get(srv.URL)
+	if err == nil {
+		//Part of the body may have been flushed already
+		defer res.Body.Close()
+		body, err = io.ReadAll(res.Body)
+		assert.NotContains(t, string(body), ErrorResourceNotFound)
+	}
+	assert.NotNil(t, err, "the client must see the stream as truncated")
+}
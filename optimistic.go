@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	VersionColumn   = "version"
+	UpdatedAtColumn = "updated_at"
+
+	DefaultConflictMaxAttempts = 3
+)
+
+// SaveOptimistic updates all the fields of model only if the row was not changed since model was read.
+// The row is matched on its version column, incremented by the update, or else on updated_at.
+// A ConflictError is returned when no row matches, the primary key and the lock column must be set
+func (db *SqlDatabase) SaveOptimistic(ctx context.Context, model interface{}) error {
+	conn := db.Conn(ctx)
+
+	stmt := &gorm.Statement{DB: conn.DB}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+
+	field := stmt.Schema.LookUpField(VersionColumn)
+	isVersion := field != nil
+	if !isVersion {
+		field = stmt.Schema.LookUpField(UpdatedAtColumn)
+	}
+	if field == nil {
+		return errors.New("optimistic-lock-column-missing-in-" + stmt.Schema.Table)
+	}
+
+	rv := reflect.ValueOf(model)
+	if rv.Kind() != reflect.Ptr {
+		return errors.New("optimistic-save-needs-a-pointer")
+	}
+	//Without its primary key the update would match every row with the same version
+	if len(stmt.Schema.PrimaryFields) == 0 {
+		return errors.New("optimistic-save-primary-key-missing-in-" + stmt.Schema.Table)
+	}
+	for _, pk := range stmt.Schema.PrimaryFields {
+		if _, isZero := pk.ValueOf(ctx, rv.Elem()); isZero {
+			return errors.New("optimistic-save-primary-key-is-zero")
+		}
+	}
+
+	current, _ := field.ValueOf(ctx, rv.Elem())
+	if cv := reflect.ValueOf(current); !cv.IsValid() || cv.Kind() == reflect.Ptr && cv.IsNil() {
+		//NULL never matches
+		return errors.New("optimistic-lock-column-is-null")
+	}
+	current = toDbPrecision(current)
+
+	if isVersion {
+		next, err := nextVersion(current)
+		if err != nil {
+			return err
+		}
+		if err := field.Set(ctx, rv.Elem(), next); err != nil {
+			return err
+		}
+	}
+
+	res := conn.Model(model).Where(field.DBName+" = ?", current).Select("*").Updates(model)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		//The model keeps what was read
+		_ = field.Set(ctx, rv.Elem(), current)
+		return ConflictError{Table: stmt.Schema.Table}
+	}
+
+	return nil
+}
+
+// toDbPrecision truncates the times to the microseconds kept by Postgres, a time set in process would never match
+func toDbPrecision(v interface{}) interface{} {
+	switch t := v.(type) {
+	case time.Time:
+		return t.Truncate(time.Microsecond)
+	case *time.Time:
+		if t != nil {
+			return t.Truncate(time.Microsecond)
+		}
+	}
+
+	return v
+}
+
+func nextVersion(v interface{}) (interface{}, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() + 1, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint() + 1, nil
+	}
+
+	return nil, errors.New("optimistic-lock-version-is-not-an-integer")
+}
+
+// UpdateWithRetry loads the record matching conds, applies mutate and saves it with SaveOptimistic.
+// On conflict the record is reloaded and mutate applied again, up to DefaultConflictMaxAttempts times
+func UpdateWithRetry[T any](ctx context.Context, db *SqlDatabase, mutate func(*T) error, conds ...interface{}) (*T, error) {
+	return UpdateWithRetryN(ctx, db, DefaultConflictMaxAttempts, mutate, conds...)
+}
+
+// UpdateWithRetryN is UpdateWithRetry trying at most maxAttempts times
+func UpdateWithRetryN[T any](ctx context.Context, db *SqlDatabase, maxAttempts int, mutate func(*T) error, conds ...interface{}) (*T, error) {
+	for attempt := 1; ; attempt++ {
+		rec := new(T)
+		if err := db.Conn(ctx).First(rec, conds...).Error; err != nil {
+			if DBErrorNotFound(err) {
+				return nil, NotFound{Err: err}
+			}
+			return nil, err
+		}
+
+		if err := mutate(rec); err != nil {
+			return nil, err
+		}
+
+		err := db.SaveOptimistic(ctx, rec)
+		if err == nil {
+			return rec, nil
+		}
+
+		var conflict ConflictError
+		if !errors.As(err, &conflict) || attempt >= maxAttempts {
+			return nil, err
+		}
+		//Let the concurrent writer finish
+		if err := sleepCtx(ctx, time.Duration(attempt)*10*time.Millisecond); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptimisticTimesMatchPostgresPrecision(t *testing.T) {
+	set := time.Date(2026, 10, 17, 10, 0, 0, 123456789, time.UTC)
+	stored := time.Date(2026, 10, 17, 10, 0, 0, 123456000, time.UTC)
+
+	assert.Equal(t, stored, toDbPrecision(set))
+	assert.Equal(t, stored, toDbPrecision(&set))
+	assert.Equal(t, int64(7), toDbPrecision(int64(7)))
+}
+
+type optimisticBook struct {
+	ID      uint
+	Title   string
+	Version int
+}
+
+type optimisticTimedBook struct {
+	ID        uint
+	UpdatedAt *time.Time
+}
+
+func TestSaveOptimisticIncrementsTheVersion(t *testing.T) {
+	db, d := newRecordingDatabase(t)
+
+	d.affected = []int64{1}
+	book := &optimisticBook{ID: 7, Title: "Book", Version: 1}
+	assert.Nil(t, db.SaveOptimistic(context.Background(), book))
+	assert.Equal(t, 2, book.Version)
+	assert.Equal(t, []string{`UPDATE "optimistic_books"`}, d.statements())
+	assert.Subset(t, d.lastArgs(), []interface{}{int64(2), int64(7), int64(1)}, "set 2 where id 7 and version 1")
+
+	err := db.SaveOptimistic(context.Background(), book)
+	assert.ErrorAs(t, err, &ConflictError{})
+	assert.Equal(t, 2, book.Version, "the model keeps what was read")
+}
+
+func TestSaveOptimisticNeedsTheKeys(t *testing.T) {
+	db, d := newRecordingDatabase(t)
+
+	assert.EqualError(t, db.SaveOptimistic(context.Background(), &optimisticBook{Version: 1}), "optimistic-save-primary-key-is-zero")
+	assert.EqualError(t, db.SaveOptimistic(context.Background(), &optimisticTimedBook{ID: 7}), "optimistic-lock-column-is-null")
+	assert.Empty(t, d.statements())
+}
+
+func TestUpdateWithRetryReloadsOnConflict(t *testing.T) {
+	db, d := newRecordingDatabase(t)
+
+	row := func(version int64) *recordedRows {
+		return &recordedRows{
+			columns: []string{"id", "title", "version"},
+			values:  [][]driver.Value{{int64(7), "Book", version}},
+		}
+	}
+	d.rows = []*recordedRows{row(1), row(2)}
+	d.affected = []int64{0, 1}
+
+	mutations := 0
+	book, err := UpdateWithRetry(context.Background(), db, func(b *optimisticBook) error {
+		mutations++
+		b.Title = "New title"
+		return nil
+	}, 7)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, mutations)
+	assert.Equal(t, 3, book.Version)
+	assert.Equal(t, []string{
+		`SELECT *`, `UPDATE "optimistic_books"`,
+		`SELECT *`, `UPDATE "optimistic_books"`,
+	}, d.statements())
+
+	d.rows = []*recordedRows{row(1), row(1)}
+	_, err = UpdateWithRetryN(context.Background(), db, 2, func(b *optimisticBook) error { return nil }, 7)
+	assert.ErrorAs(t, err, &ConflictError{})
+}
@@ -0,0 +1,112 @@
+package pagination
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/4books-sparta/utils"
+	"github.com/4books-sparta/utils/requests"
+)
+
+const (
+	ErrorInvalidCursor        = "invalid-cursor"
+	ErrorCursorSecretTooShort = "cursor-secret-too-short"
+
+	// MinSecretLength is the size of the SHA-256 key, shorter secrets can be guessed
+	MinSecretLength = 32
+)
+
+// Cursor holds the sort keys of the row bounding a page
+type Cursor struct {
+	Values []interface{} `json:"v"`
+	// Backward cursors read the page before the row
+	Backward bool `json:"b,omitempty"`
+	// Sort is the signature of the ordering the cursor was built for
+	Sort string `json:"s"`
+}
+
+// Codec makes the cursors opaque to the clients and detects tampering
+type Codec struct {
+	secret []byte
+}
+
+// NewCodec returns an error for secrets shorter than MinSecretLength bytes
+func NewCodec(secret []byte) (*Codec, error) {
+	if len(secret) < MinSecretLength {
+		return nil, errors.New(ErrorCursorSecretTooShort)
+	}
+
+	return &Codec{secret: secret}, nil
+}
+
+func (c *Codec) Encode(cur Cursor) (string, error) {
+	b, err := json.Marshal(cur)
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(c.sign(payload)), nil
+}
+
+// Decode returns an InvalidRequestError when the cursor was not produced by the codec
+func (c *Codec) Decode(s string) (*Cursor, error) {
+	invalid := utils.InvalidRequestError{Err: errors.New(ErrorInvalidCursor)}
+
+	payload, sig, ok := strings.Cut(s, ".")
+	if !ok {
+		return nil, invalid
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, c.sign(payload)) {
+		return nil, invalid
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, invalid
+	}
+
+	//Numbers stay json.Number, so that big ids keep their precision
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	cur := &Cursor{}
+	if err := dec.Decode(cur); err != nil {
+		return nil, invalid
+	}
+
+	return cur, nil
+}
+
+func (c *Codec) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// Keyset builds the keyset of a request, an empty cursor reads the first page
+func (c *Codec) Keyset(req requests.CursorPagedRequest, order ...Order) (Keyset, error) {
+	k := Keyset{
+		Order: order,
+		Limit: int(req.Limit),
+	}
+	if req.Cursor == "" {
+		return k, nil
+	}
+
+	cur, err := c.Decode(req.Cursor)
+	if err != nil {
+		return k, err
+	}
+	if cur.Sort != k.signature() {
+		return k, utils.InvalidRequestError{Err: errors.New(ErrorInvalidCursor)}
+	}
+	k.Cursor = cur
+
+	return k, nil
+}
@@ -0,0 +1,98 @@
+package pagination
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// Order is a sort column, it must never come unchecked from the request
+type Order struct {
+	Column string
+	Desc   bool
+}
+
+// Keyset paginates on the values of the order columns, the last one must be unique (e.g. the id)
+type Keyset struct {
+	Order  []Order
+	Limit  int
+	Cursor *Cursor
+}
+
+func (k Keyset) limit() int {
+	if k.Limit <= 0 {
+		return DefaultLimit
+	}
+	if k.Limit > MaxLimit {
+		return MaxLimit
+	}
+	return k.Limit
+}
+
+func (k Keyset) signature() string {
+	parts := make([]string, 0, len(k.Order))
+	for _, o := range k.Order {
+		if o.Desc {
+			parts = append(parts, o.Column+" desc")
+		} else {
+			parts = append(parts, o.Column)
+		}
+	}
+
+	return strings.Join(parts, ",")
+}
+
+func (k Keyset) backward() bool {
+	return k.Cursor != nil && k.Cursor.Backward
+}
+
+// Scope applies the keyset condition, the ordering and a limit one row larger than the page to detect more rows
+func (k Keyset) Scope(db *gorm.DB) *gorm.DB {
+	if len(k.Order) == 0 {
+		_ = db.AddError(errors.New("keyset-order-missing"))
+		return db
+	}
+
+	backward := k.backward()
+	if k.Cursor != nil {
+		if k.Cursor.Sort != k.signature() || len(k.Cursor.Values) != len(k.Order) {
+			_ = db.AddError(errors.New(ErrorInvalidCursor))
+			return db
+		}
+
+		//(a > ?) OR (a = ? AND b > ?) OR ... with the comparison flipped for descending columns and backward pages
+		ors := make([]string, 0, len(k.Order))
+		args := make([]interface{}, 0)
+		for i, o := range k.Order {
+			conds := make([]string, 0, i+1)
+			for j := 0; j < i; j++ {
+				conds = append(conds, db.Statement.Quote(k.Order[j].Column)+" = ?")
+				args = append(args, k.Cursor.Values[j])
+			}
+			op := ">"
+			if o.Desc != backward {
+				op = "<"
+			}
+			conds = append(conds, db.Statement.Quote(o.Column)+" "+op+" ?")
+			args = append(args, k.Cursor.Values[i])
+			ors = append(ors, "("+strings.Join(conds, " AND ")+")")
+		}
+		db = db.Where("("+strings.Join(ors, " OR ")+")", args...)
+	}
+
+	for _, o := range k.Order {
+		dir := " ASC"
+		if o.Desc != backward {
+			dir = " DESC"
+		}
+		db = db.Order(db.Statement.Quote(o.Column) + dir)
+	}
+
+	return db.Limit(k.limit() + 1)
+}
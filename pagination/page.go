@@ -0,0 +1,48 @@
+package pagination
+
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+// NewPage builds the page from the rows read with Keyset.Scope, keys returns the order column values of a row
+func NewPage[T any](rows []T, k Keyset, codec *Codec, keys func(T) []interface{}) (Page[T], error) {
+	limit := k.limit()
+	more := len(rows) > limit
+	if more {
+		rows = rows[:limit]
+	}
+
+	backward := k.backward()
+	if backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	page := Page[T]{Items: rows}
+	if len(rows) == 0 {
+		return page, nil
+	}
+
+	//Coming back from a later page there is always a next one, and vice versa
+	hasNext := (!backward && more) || backward
+	hasPrev := (backward && more) || (!backward && k.Cursor != nil)
+
+	var err error
+	if hasNext {
+		page.NextCursor, err = codec.Encode(Cursor{Values: keys(rows[len(rows)-1]), Sort: k.signature()})
+		if err != nil {
+			return page, err
+		}
+	}
+	if hasPrev {
+		page.PrevCursor, err = codec.Encode(Cursor{Values: keys(rows[0]), Backward: true, Sort: k.signature()})
+		if err != nil {
+			return page, err
+		}
+	}
+
+	return page, nil
+}
@@ -0,0 +1,52 @@
+package pagination
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"github.com/4books-sparta/utils/requests"
+)
+
+type user struct {
+	Id    uint64
+	Email string
+}
+
+func userKeys(u user) []interface{} {
+	return []interface{}{u.Email, u.Id}
+}
+
+func TestKeysetScopeAndCursors(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	assert.Nil(t, err)
+	_, err = NewCodec([]byte("secret"))
+	assert.NotNil(t, err)
+	codec, err := NewCodec([]byte("0123456789abcdef0123456789abcdef"))
+	assert.Nil(t, err)
+	order := []Order{{Column: "email"}, {Column: "id", Desc: true}}
+
+	k, err := codec.Keyset(requests.CursorPagedRequest{Limit: 2}, order...)
+	assert.Nil(t, err)
+	page, err := NewPage([]user{{1, "a"}, {2, "b"}, {3, "c"}}, k, codec, userKeys)
+	assert.Nil(t, err)
+	assert.Len(t, page.Items, 2)
+	assert.Empty(t, page.PrevCursor)
+
+	k, err = codec.Keyset(requests.CursorPagedRequest{Cursor: page.NextCursor, Limit: 2}, order...)
+	assert.Nil(t, err)
+	stmt := db.Model(&user{}).Scopes(k.Scope).Find(&[]user{}).Statement
+	assert.Equal(t, `SELECT * FROM "users" WHERE (("email" > $1) OR ("email" = $2 AND "id" < $3)) ORDER BY "email" ASC,"id" DESC LIMIT $4`, stmt.SQL.String())
+	assert.Equal(t, "b", stmt.Vars[0])
+
+	page, _ = NewPage([]user{{3, "c"}}, k, codec, userKeys)
+	assert.Empty(t, page.NextCursor)
+	assert.NotEmpty(t, page.PrevCursor)
+
+	_, err = codec.Keyset(requests.CursorPagedRequest{Cursor: page.PrevCursor + "x"}, order...)
+	assert.NotNil(t, err)
+	_, err = codec.Keyset(requests.CursorPagedRequest{Cursor: page.PrevCursor}, Order{Column: "id"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,181 @@
+package utils
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/4books-sparta/utils/models"
+)
+
+const (
+	QueryTagName = "query"
+	// QueryTagDate formats time values with models.DayLayout instead of models.DayHourLayout
+	QueryTagDate = "date"
+	// QueryTagOmitEmpty skips zero values
+	QueryTagOmitEmpty = "omitempty"
+)
+
+var (
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	timeType          = reflect.TypeOf(time.Time{})
+)
+
+// EncodeQuery converts a struct to url.Values using the `query:"name,omitempty,date"` tags.
+// Fields without a query tag fall back to their json name, embedded structs are flattened
+func EncodeQuery(v interface{}) (url.Values, error) {
+	ret := url.Values{}
+	if v == nil {
+		return ret, nil
+	}
+
+	switch vv := v.(type) {
+	case url.Values:
+		return vv, nil
+	case map[string]string:
+		for k, s := range vv {
+			ret.Set(k, s)
+		}
+		return ret, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return ret, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, errors.New("query-encoding-needs-a-struct")
+	}
+
+	return ret, encodeQueryStruct(rv, ret)
+}
+
+func encodeQueryStruct(rv reflect.Value, ret url.Values) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		fv := rv.Field(i)
+
+		name, opts, tagged := QueryFieldName(sf)
+		if name == "-" {
+			continue
+		}
+
+		if sf.Anonymous && !tagged {
+			for fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					break
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				if err := encodeQueryStruct(fv, ret); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		if !sf.IsExported() {
+			continue
+		}
+
+		if opts[QueryTagOmitEmpty] && fv.IsZero() {
+			continue
+		}
+
+		values, err := queryValues(fv, opts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		for _, s := range values {
+			ret.Add(name, s)
+		}
+	}
+
+	return nil
+}
+
+// QueryFieldName returns the query parameter of a struct field with the options of its tag,
+// tagged is false when the name comes from the json tag or the field name
+func QueryFieldName(sf reflect.StructField) (name string, opts map[string]bool, tagged bool) {
+	opts = map[string]bool{}
+
+	tag, tagged := sf.Tag.Lookup(QueryTagName)
+	if !tagged {
+		tag = sf.Tag.Get("json")
+	}
+
+	parts := strings.Split(tag, ",")
+	for _, o := range parts[1:] {
+		opts[o] = true
+	}
+
+	name = parts[0]
+	if name == "" {
+		name = sf.Name
+	}
+
+	return name, opts, tagged
+}
+
+func queryValues(fv reflect.Value, opts map[string]bool) ([]string, error) {
+	for fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return nil, nil
+		}
+		fv = fv.Elem()
+	}
+
+	if fv.Type() == timeType {
+		t := fv.Interface().(time.Time)
+		if t.IsZero() {
+			return nil, nil
+		}
+		if opts[QueryTagDate] {
+			return []string{t.Format(models.DayLayout)}, nil
+		}
+		return []string{t.Format(models.DayHourLayout)}, nil
+	}
+
+	if fv.Type().Implements(textMarshalerType) {
+		b, err := fv.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		return []string{string(b)}, nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		return []string{fv.String()}, nil
+	case reflect.Bool:
+		return []string{strconv.FormatBool(fv.Bool())}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return []string{strconv.FormatInt(fv.Int(), 10)}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return []string{strconv.FormatUint(fv.Uint(), 10)}, nil
+	case reflect.Float32, reflect.Float64:
+		return []string{strconv.FormatFloat(fv.Float(), 'f', -1, fv.Type().Bits())}, nil
+	case reflect.Slice, reflect.Array:
+		ret := make([]string, 0, fv.Len())
+		for i := 0; i < fv.Len(); i++ {
+			vv, err := queryValues(fv.Index(i), opts)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, vv...)
+		}
+		return ret, nil
+	}
+
+	return nil, errors.New("unsupported-query-type-" + fv.Kind().String())
+}
@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+
+	"github.com/4books-sparta/utils/ratelimit"
+)
+
+const (
+	RateLimitCtxKey = "req-rate-limit"
+
+	ErrorRateLimited = "rate-limit-exceeded"
+)
+
+// RateLimitKeyFunc returns the client key of a request, the request is not limited when it is empty
+type RateLimitKeyFunc func(ctx context.Context) string
+
+type RateLimitPolicy struct {
+	Limiter ratelimit.Limiter
+	// Key identifies the client, RateLimitByIP when nil
+	Key RateLimitKeyFunc
+	// FailOpen lets the requests through when the limiter fails, e.g. Redis is down
+	FailOpen bool
+	// TrustedProxies is the number of proxies appending to X-Forwarded-For in front of the service,
+	// 1 (the load balancer) when zero. The entries on their left are set by the client and are ignored.
+	TrustedProxies int
+}
+
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e RateLimitError) Error() string {
+	return ErrorRateLimited
+}
+
+func (e RateLimitError) Code() int {
+	return http.StatusTooManyRequests
+}
+
+// Headers implements kitHttp.Headerer, it is written by the error encoder
+func (e RateLimitError) Headers() http.Header {
+	return http.Header{"Retry-After": []string{strconv.Itoa(e.retryAfterSeconds())}}
+}
+
+func (e RateLimitError) MessageArgs() []interface{} {
+	return []interface{}{e.retryAfterSeconds()}
+}
+
+func (e RateLimitError) retryAfterSeconds() int {
+	secs := int(math.Ceil(e.RetryAfter.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+
+	return secs
+}
+
+type rateLimitRequest struct {
+	ip       string
+	apiToken string
+}
+
+// WithRateLimit limits the requests of every endpoint built by the Forwarder
+func (f *Forwarder) WithRateLimit(p *RateLimitPolicy) *Forwarder {
+	f.rateLimit = p
+	return f
+}
+
+func (f *Forwarder) plugRateLimit(ctx context.Context, req *http.Request) context.Context {
+	return context.WithValue(ctx, RateLimitCtxKey, rateLimitRequest{
+		ip:       clientIP(req, f.rateLimit.TrustedProxies),
+		apiToken: ExtractApiToken(req),
+	})
+}
+
+// clientIP is the X-Forwarded-For address added by the outermost trusted proxy, the remote address without proxies
+func clientIP(req *http.Request, trustedProxies int) string {
+	if trustedProxies <= 0 {
+		trustedProxies = 1
+	}
+
+	var hops []string
+	for _, h := range req.Header.Values("X-Forwarded-For") {
+		for _, ip := range strings.Split(h, ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				hops = append(hops, ip)
+			}
+		}
+	}
+	if len(hops) > 0 {
+		return hops[max(len(hops)-trustedProxies, 0)]
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+
+	return host
+}
+
+func RateLimitByIP(ctx context.Context) string {
+	r, _ := ctx.Value(RateLimitCtxKey).(rateLimitRequest)
+	if r.ip == "" {
+		return ""
+	}
+
+	return "ip:" + r.ip
+}
+
+// RateLimitByUser keys on the authenticated user, anonymous requests are keyed on the IP
+func RateLimitByUser(ctx context.Context) string {
+	if auth, ok := AuthorizationFromContext(ctx); ok && auth.Error == nil && auth.User != "" {
+		return "user:" + auth.User
+	}
+
+	return RateLimitByIP(ctx)
+}
+
+// RateLimitByApiToken keys on the x-auth-token header, the requests without it are keyed on the IP
+func RateLimitByApiToken(ctx context.Context) string {
+	r, _ := ctx.Value(RateLimitCtxKey).(rateLimitRequest)
+	if r.apiToken == "" {
+		return RateLimitByIP(ctx)
+	}
+
+	//The token does not end up in the store
+	h := sha256.Sum256([]byte(r.apiToken))
+	return "token:" + hex.EncodeToString(h[:16])
+}
+
+// Wrap returns an endpoint middleware enforcing the policy
+func (p *RateLimitPolicy) Wrap(actual endpoint.Endpoint) endpoint.Endpoint {
+	keyFn := p.Key
+	if keyFn == nil {
+		keyFn = RateLimitByIP
+	}
+
+	return func(ctx context.Context, req interface{}) (interface{}, error) {
+		key := keyFn(ctx)
+		if key == "" {
+			return actual(ctx, req)
+		}
+
+		res, err := p.Limiter.Allow(ctx, key)
+		if err != nil {
+			if p.FailOpen {
+				return actual(ctx, req)
+			}
+			return nil, err
+		}
+		if !res.Allowed {
+			return nil, RateLimitError{RetryAfter: res.RetryAfter}
+		}
+
+		return actual(ctx, req)
+	}
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+)
+
+type Algorithm string
+
+const (
+	// TokenBucket refills Limit.Requests tokens every Limit.Period, allowing bursts up to Limit.Burst
+	TokenBucket = Algorithm("token-bucket")
+	// SlidingWindow weights the previous window counter to smooth the edges of fixed windows
+	SlidingWindow = Algorithm("sliding-window")
+
+	ErrorUnknownAlgorithm = "unknown-rate-limit-algorithm"
+	ErrorInvalidLimit     = "invalid-rate-limit"
+)
+
+type Limit struct {
+	// Requests allowed every Period
+	Requests int
+	Period   time.Duration
+	// Burst is the capacity of the token bucket, Requests when zero
+	Burst int
+}
+
+func (l Limit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Requests)
+}
+
+// ratePerMs is the token bucket refill rate, periods are counted in whole milliseconds
+func (l Limit) ratePerMs() float64 {
+	return float64(l.Requests) / float64(max(l.Period.Milliseconds(), 1))
+}
+
+func checkLimit(l Limit) error {
+	if l.Requests <= 0 || l.Period < time.Millisecond || l.Burst < 0 {
+		return errors.New(ErrorInvalidLimit)
+	}
+	return nil
+}
+
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is set on denied requests
+	RetryAfter time.Duration
+}
+
+type Limiter interface {
+	Allow(ctx context.Context, key string) (Result, error)
+}
+
+func checkAlgorithm(alg Algorithm) error {
+	switch alg {
+	case TokenBucket, SlidingWindow:
+		return nil
+	}
+	return errors.New(ErrorUnknownAlgorithm)
+}
+
+// tokenBucketResult builds the result from the tokens left after the request
+func tokenBucketResult(l Limit, allowed bool, tokens float64) Result {
+	ret := Result{Allowed: allowed, Remaining: int(math.Floor(tokens))}
+	if !allowed {
+		ret.RetryAfter = time.Duration((1-tokens)/l.ratePerMs()) * time.Millisecond
+	}
+	return ret
+}
+
+// slidingWindowResult decides on a request given the counters of the current and previous windows
+func slidingWindowResult(l Limit, now time.Time, windowStart time.Time, prev int, curr int) Result {
+	estimate := float64(prev)*slidingWindowWeight(l, now, windowStart) + float64(curr)
+
+	if estimate+1 <= float64(l.Requests) {
+		return Result{
+			Allowed:   true,
+			Remaining: int(math.Floor(float64(l.Requests) - estimate - 1)),
+		}
+	}
+
+	//Wait until the previous window weighs little enough, or for the next window
+	retry := windowStart.Add(l.Period).Sub(now)
+	free := float64(l.Requests - 1 - curr)
+	if prev > 0 && free >= 0 {
+		needed := 1 - free/float64(prev)
+		retry = time.Duration(needed*float64(l.Period)) - now.Sub(windowStart)
+	}
+
+	return Result{RetryAfter: retry}
+}
+
+// slidingWindowWeight is the weight of the previous window counter at now
+func slidingWindowWeight(l Limit, now time.Time, windowStart time.Time) float64 {
+	return 1 - float64(now.Sub(windowStart))/float64(l.Period)
+}
@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type memoryState struct {
+	//Token bucket
+	tokens float64
+	last   time.Time
+	//Sliding window
+	windowStart time.Time
+	prev        int
+	curr        int
+}
+
+// MemoryLimiter keeps the counters in process, limits are enforced per replica
+type MemoryLimiter struct {
+	alg       Algorithm
+	limit     Limit
+	mu        sync.Mutex
+	states    map[string]*memoryState
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryLimiter(alg Algorithm, l Limit) (*MemoryLimiter, error) {
+	if err := checkAlgorithm(alg); err != nil {
+		return nil, err
+	}
+	if err := checkLimit(l); err != nil {
+		return nil, err
+	}
+
+	return &MemoryLimiter{
+		alg:    alg,
+		limit:  l,
+		states: make(map[string]*memoryState),
+		now:    time.Now,
+	}, nil
+}
+
+func (m *MemoryLimiter) Allow(_ context.Context, key string) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	st, ok := m.states[key]
+	if !ok {
+		st = &memoryState{
+			tokens:      m.limit.capacity(),
+			last:        now,
+			windowStart: now.Truncate(m.limit.Period),
+		}
+		m.states[key] = st
+	}
+
+	if m.alg == TokenBucket {
+		return m.takeToken(st, now), nil
+	}
+
+	return m.countInWindow(st, now), nil
+}
+
+func (m *MemoryLimiter) takeToken(st *memoryState, now time.Time) Result {
+	elapsed := float64(now.Sub(st.last).Milliseconds())
+	st.tokens = math.Min(m.limit.capacity(), st.tokens+math.Max(0, elapsed)*m.limit.ratePerMs())
+	st.last = now
+
+	allowed := st.tokens >= 1
+	if allowed {
+		st.tokens--
+	}
+
+	return tokenBucketResult(m.limit, allowed, st.tokens)
+}
+
+func (m *MemoryLimiter) countInWindow(st *memoryState, now time.Time) Result {
+	ws := now.Truncate(m.limit.Period)
+	if !ws.Equal(st.windowStart) {
+		if ws.Sub(st.windowStart) == m.limit.Period {
+			st.prev = st.curr
+		} else {
+			st.prev = 0
+		}
+		st.curr = 0
+		st.windowStart = ws
+	}
+
+	res := slidingWindowResult(m.limit, now, ws, st.prev, st.curr)
+	if res.Allowed {
+		st.curr++
+	}
+
+	return res
+}
+
+// sweep forgets the keys whose state went back to the initial one
+func (m *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < m.limit.Period {
+		return
+	}
+	m.lastSweep = now
+
+	for k, st := range m.states {
+		idle := false
+		if m.alg == TokenBucket {
+			refilled := st.tokens + float64(now.Sub(st.last).Milliseconds())*m.limit.ratePerMs()
+			idle = refilled >= m.limit.capacity()
+		} else {
+			idle = now.Sub(st.windowStart) >= 2*m.limit.Period
+		}
+		if idle {
+			delete(m.states, k)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testLimiter(t *testing.T, alg Algorithm, l Limit) (*MemoryLimiter, *time.Time) {
+	m, err := NewMemoryLimiter(alg, l)
+	assert.Nil(t, err)
+
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	m.now = func() time.Time {
+		return now
+	}
+
+	return m, &now
+}
+
+func TestTokenBucketRefills(t *testing.T) {
+	m, now := testLimiter(t, TokenBucket, Limit{Requests: 2, Period: time.Second})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		res, _ := m.Allow(ctx, "k")
+		assert.True(t, res.Allowed)
+	}
+	res, _ := m.Allow(ctx, "k")
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+
+	other, _ := m.Allow(ctx, "other")
+	assert.True(t, other.Allowed)
+
+	*now = now.Add(500 * time.Millisecond)
+	res, _ = m.Allow(ctx, "k")
+	assert.True(t, res.Allowed)
+}
+
+func TestSlidingWindowWeightsPreviousWindow(t *testing.T) {
+	m, now := testLimiter(t, SlidingWindow, Limit{Requests: 4, Period: time.Minute})
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		res, _ := m.Allow(ctx, "k")
+		assert.True(t, res.Allowed)
+	}
+	res, _ := m.Allow(ctx, "k")
+	assert.False(t, res.Allowed)
+
+	//At the start of the next window the previous one still counts fully
+	*now = now.Add(time.Minute)
+	res, _ = m.Allow(ctx, "k")
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 15*time.Second, res.RetryAfter)
+
+	*now = now.Add(15 * time.Second)
+	res, _ = m.Allow(ctx, "k")
+	assert.True(t, res.Allowed)
+}
+
+func TestInvalidLimits(t *testing.T) {
+	for _, l := range []Limit{{Requests: 1, Period: time.Microsecond}, {Requests: 0, Period: time.Second}, {Requests: 1, Period: time.Second, Burst: -1}} {
+		_, err := NewMemoryLimiter(TokenBucket, l)
+		assert.EqualError(t, err, ErrorInvalidLimit)
+	}
+}
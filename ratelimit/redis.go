@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil then
+	tokens = capacity
+	ts = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return {allowed, tostring(tokens)}
+`)
+
+var slidingWindowScript = redis.NewScript(`
+local curr = tonumber(redis.call('GET', KEYS[1]) or '0')
+local prev = tonumber(redis.call('GET', KEYS[2]) or '0')
+if prev * tonumber(ARGV[1]) + curr + 1 > tonumber(ARGV[2]) then
+	return {0, curr, prev}
+end
+redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return {1, curr, prev}
+`)
+
+// RedisLimiter keeps the counters in Redis so that limits hold across replicas.
+// Each check is a single script, hence atomic
+type RedisLimiter struct {
+	client redis.UniversalClient
+	prefix string
+	alg    Algorithm
+	limit  Limit
+	now    func() time.Time
+}
+
+func NewRedisLimiter(c redis.UniversalClient, prefix string, alg Algorithm, l Limit) (*RedisLimiter, error) {
+	if err := checkAlgorithm(alg); err != nil {
+		return nil, err
+	}
+	if err := checkLimit(l); err != nil {
+		return nil, err
+	}
+
+	return &RedisLimiter{
+		client: c,
+		prefix: prefix,
+		alg:    alg,
+		limit:  l,
+		now:    time.Now,
+	}, nil
+}
+
+func (r *RedisLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	now := r.now()
+	//The hash tag keeps the keys of a client on the same cluster slot
+	base := r.prefix + "{" + key + "}"
+
+	if r.alg == TokenBucket {
+		ttl := 2 * r.limit.Period
+		if refill := time.Duration(r.limit.capacity()/r.limit.ratePerMs()) * time.Millisecond; refill > ttl {
+			ttl = refill
+		}
+		ret, err := tokenBucketScript.Run(ctx, r.client, []string{base},
+			r.limit.capacity(), r.limit.ratePerMs(), now.UnixMilli(), ttl.Milliseconds()).Slice()
+		if err != nil {
+			return Result{}, err
+		}
+		allowed, _ := ret[0].(int64)
+		tokensStr, _ := ret[1].(string)
+		tokens, err := strconv.ParseFloat(tokensStr, 64)
+		if err != nil {
+			return Result{}, err
+		}
+
+		return tokenBucketResult(r.limit, allowed == 1, tokens), nil
+	}
+
+	ws := now.Truncate(r.limit.Period)
+	idx := ws.UnixMilli() / r.limit.Period.Milliseconds()
+	keys := []string{
+		base + ":" + strconv.FormatInt(idx, 10),
+		base + ":" + strconv.FormatInt(idx-1, 10),
+	}
+	ret, err := slidingWindowScript.Run(ctx, r.client, keys,
+		slidingWindowWeight(r.limit, now, ws), r.limit.Requests, (2 * r.limit.Period).Milliseconds()).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	allowed, _ := ret[0].(int64)
+	curr, _ := ret[1].(int64)
+	prev, _ := ret[2].(int64)
+
+	//The script applies the same rule, the details are rebuilt from the counters it read
+	res := slidingWindowResult(r.limit, now, ws, int(prev), int(curr))
+	if res.Allowed != (allowed == 1) {
+		res = Result{Allowed: allowed == 1}
+		if !res.Allowed {
+			res.RetryAfter = time.Millisecond
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/4books-sparta/utils/ratelimit"
+)
+
+func TestForwarderRateLimit(t *testing.T) {
+	limiter, _ := ratelimit.NewMemoryLimiter(ratelimit.TokenBucket, ratelimit.Limit{Requests: 1, Period: time.Minute})
+	f := NewForwarder(nil).WithRateLimit(&RateLimitPolicy{Limiter: limiter, Key: RateLimitByApiToken})
+
+	e := func(context.Context, interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	dec := func(context.Context, *http.Request) (interface{}, error) {
+		return nil, nil
+	}
+	h := f.Forward(e, dec)
+
+	call := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(AuthTokenHeaderName, token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, call("a").Code)
+
+	w := call("a")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), ErrorRateLimited)
+
+	assert.Equal(t, http.StatusOK, call("b").Code)
+}
+
+func TestClientIPIgnoresSpoofedForwardedFor(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	assert.Equal(t, "10.0.0.1", clientIP(req, 0))
+
+	req.Header.Set("X-Forwarded-For", "1.2.3.4, 5.6.7.8")
+	req.Header.Add("X-Forwarded-For", "9.9.9.9")
+	assert.Equal(t, "9.9.9.9", clientIP(req, 0))
+	assert.Equal(t, "5.6.7.8", clientIP(req, 2))
+	assert.Equal(t, "1.2.3.4", clientIP(req, 5))
+}
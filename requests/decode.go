@@ -23,16 +23,17 @@ func DecodeGetByIntIdRequest(_ context.Context, req *http.Request) (interface{},
 
 func DecodeQueryPagedRequest(_ context.Context, req *http.Request) (interface{}, error) {
 	var request PagedRequest
-
-	if limit, ok := req.URL.Query()["limit"]; ok && len(limit) > 0 {
-		if v, err := strconv.Atoi(limit[0]); err == nil {
-			request.Limit = uint(v)
-		}
+	if err := DecodeQuery(req, &request); err != nil {
+		return nil, err
 	}
-	if offset, ok := req.URL.Query()["offset"]; ok && len(offset) > 0 {
-		if v, err := strconv.Atoi(offset[0]); err == nil {
-			request.Offset = uint(v)
-		}
+
+	return request, nil
+}
+
+func DecodeQueryCursorPagedRequest(_ context.Context, req *http.Request) (interface{}, error) {
+	var request CursorPagedRequest
+	if err := DecodeQuery(req, &request); err != nil {
+		return nil, err
 	}
 
 	return request, nil
@@ -0,0 +1,221 @@
+package requests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"goji.io/pattern"
+
+	"github.com/4books-sparta/utils"
+	"github.com/4books-sparta/utils/models"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// DecodeQuery fills the fields of dst tagged with path:"name", the others are read from the query
+// with the names of utils.EncodeQuery, embedded structs included, then validates it. Slices take repeated or comma separated values, times are days or RFC 3339 timestamps.
+// Malformed values and failed validations are returned as an InvalidRequestError with per-field details.
+func DecodeQuery(req *http.Request, dst interface{}) error {
+	return DecodeQueryCtx(req.Context(), req, dst)
+}
+
+// DecodeQueryCtx is DecodeQuery reading the path variables and the locale of the messages from ctx,
+// e.g. the context built by the go-kit ServerBefore functions
+func DecodeQueryCtx(ctx context.Context, req *http.Request, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return errors.New("decode-query-needs-a-struct-pointer")
+	}
+
+	errs := utils.ParameterErrors{}
+	decodeStruct(ctx, req, v.Elem(), errs)
+	if len(errs) > 0 {
+		return utils.InvalidRequestError{Err: errs}
+	}
+
+	if err := utils.ValidateRequestCtx(ctx, dst); err != nil {
+		return utils.InvalidRequestError{Err: err}
+	}
+
+	return nil
+}
+
+// QueryDecoder returns a go-kit request decoder of T, see DecodeQuery
+func QueryDecoder[T any]() func(context.Context, *http.Request) (interface{}, error) {
+	return func(ctx context.Context, req *http.Request) (interface{}, error) {
+		var request T
+		if err := DecodeQueryCtx(ctx, req, &request); err != nil {
+			return nil, err
+		}
+
+		return request, nil
+	}
+}
+
+// decodeStruct returns true when a value has been set
+func decodeStruct(ctx context.Context, req *http.Request, v reflect.Value, errs utils.ParameterErrors) bool {
+	t := v.Type()
+	query := req.URL.Query()
+
+	set := false
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fv := v.Field(i)
+
+		name := sf.Tag.Get("path")
+		isPath, tagged := name != "", true
+		if !isPath {
+			name, _, tagged = utils.QueryFieldName(sf)
+		}
+		if name == "-" {
+			continue
+		}
+
+		if sf.Anonymous && !tagged {
+			if embedded, ok := decodeEmbedded(ctx, req, fv, errs); ok {
+				set = set || embedded
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+
+		var values []string
+		if isPath {
+			if p, ok := ctx.Value(pattern.Variable(name)).(string); ok {
+				values = []string{p}
+			}
+		} else {
+			values = query[name]
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		if err := setField(fv, values); err != nil {
+			errs[name] = err.Error()
+		}
+		set = true
+	}
+
+	return set
+}
+
+// decodeEmbedded decodes the embedded structs, a nil pointer is allocated only when one of its fields is in the request
+func decodeEmbedded(ctx context.Context, req *http.Request, fv reflect.Value, errs utils.ParameterErrors) (set bool, ok bool) {
+	switch {
+	case fv.Kind() == reflect.Struct:
+		return decodeStruct(ctx, req, fv, errs), true
+	case fv.Kind() != reflect.Ptr || fv.Type().Elem().Kind() != reflect.Struct:
+		return false, false
+	case !fv.IsNil():
+		return decodeStruct(ctx, req, fv.Elem(), errs), true
+	case !fv.CanSet():
+		//An unexported nil pointer cannot be allocated
+		return false, true
+	}
+
+	n := reflect.New(fv.Type().Elem())
+	if decodeStruct(ctx, req, n.Elem(), errs) {
+		fv.Set(n)
+		return true, true
+	}
+
+	return false, true
+}
+
+func setField(fv reflect.Value, values []string) error {
+	if fv.Kind() == reflect.Ptr {
+		n := reflect.New(fv.Type().Elem())
+		if err := setField(n.Elem(), values); err != nil {
+			return err
+		}
+		fv.Set(n)
+		return nil
+	}
+
+	if fv.Kind() == reflect.Slice {
+		var parts []string
+		for _, v := range values {
+			for _, p := range strings.Split(v, ",") {
+				if p = strings.TrimSpace(p); p != "" {
+					parts = append(parts, p)
+				}
+			}
+		}
+
+		s := reflect.MakeSlice(fv.Type(), len(parts), len(parts))
+		for i, p := range parts {
+			if err := setScalar(s.Index(i), p); err != nil {
+				return err
+			}
+		}
+		fv.Set(s)
+		return nil
+	}
+
+	return setScalar(fv, values[0])
+}
+
+func setScalar(fv reflect.Value, s string) error {
+	if fv.Type() == timeType {
+		t, err := parseTime(s)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		fv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return errors.New("must be a positive integer")
+		}
+		fv.SetUint(u)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.New("must be a boolean")
+		}
+		fv.SetBool(b)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		fv.SetFloat(f)
+	default:
+		return errors.New("unsupported type " + fv.Type().String())
+	}
+
+	return nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(models.DayHourLayout, s); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(models.DayLayout, s)
+	if err != nil {
+		return t, errors.New("must be a date, " + models.DayLayout + " or " + models.DayHourLayout)
+	}
+
+	return t, nil
+}
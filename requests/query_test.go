@@ -0,0 +1,99 @@
+package requests
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"goji.io/pattern"
+
+	"github.com/4books-sparta/utils"
+)
+
+type searchRequest struct {
+	LocalizedPagedUserSearchRequest
+	Id      int        `path:"id"`
+	Tags    []uint32   `query:"tags"`
+	Free    *bool      `query:"free"`
+	Since   time.Time  `query:"since"`
+	Until   *time.Time `query:"until"`
+	ignored string     `query:"ignored"`
+}
+
+func TestDecodeQuery(t *testing.T) {
+	req := httptest.NewRequest("GET", "/conts/7?locale=it&limit=10&user_id=3&tags=1,2&tags=3&free=true&since=2021-05-01&until=2021-05-02T10:00:00Z", nil)
+	req = req.WithContext(context.WithValue(req.Context(), pattern.Variable("id"), "7"))
+
+	var r searchRequest
+	assert.Nil(t, DecodeQuery(req, &r))
+	assert.Equal(t, "it", r.Locale)
+	assert.Equal(t, uint(10), r.Limit)
+	assert.Equal(t, uint32(3), r.UserId)
+	assert.Equal(t, 7, r.Id)
+	assert.Equal(t, []uint32{1, 2, 3}, r.Tags)
+	assert.True(t, *r.Free)
+	assert.Equal(t, time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC), r.Since)
+	assert.Equal(t, 10, r.Until.Hour())
+
+	req = httptest.NewRequest("GET", "/conts?locale=it&limit=-1&since=yesterday", nil)
+	err := DecodeQuery(req, &searchRequest{})
+	var invalid utils.InvalidRequestError
+	assert.True(t, errors.As(err, &invalid))
+	env := utils.NewErrorEnvelope(err, "")
+	assert.Equal(t, utils.ErrorInvalidParameters, env.Key)
+	assert.Contains(t, env.Details, "limit")
+	assert.Contains(t, env.Details, "since")
+
+	req = httptest.NewRequest("GET", "/conts?limit=1", nil)
+	err = DecodeQuery(req, &searchRequest{})
+	assert.True(t, errors.As(err, &invalid))
+	assert.Equal(t, utils.ErrorValidationFailed, utils.NewErrorEnvelope(err, "").Key)
+}
+
+func TestQueryDecoderUsesItsContext(t *testing.T) {
+	req := httptest.NewRequest("GET", "/conts/7?limit=1", nil)
+	ctx := utils.WithLocale(context.WithValue(req.Context(), pattern.Variable("id"), "7"), utils.EnLocale)
+
+	_, err := QueryDecoder[searchRequest]()(ctx, req)
+	var verr utils.ValidationError
+	assert.True(t, errors.As(err, &verr))
+	assert.Equal(t, utils.EnLocale, verr.Locale)
+}
+
+type roundTripPage struct {
+	Page uint `json:"page,omitempty"`
+}
+
+type roundTripRequest struct {
+	*roundTripPage
+	*PagedRequest
+	Title  string    `query:"title,omitempty"`
+	Day    time.Time `query:"day,omitempty,date"`
+	Ids    []int     `json:"ids,omitempty"`
+	Hidden string    `json:"-"`
+}
+
+func TestDecodeQueryReadsEncodeQuery(t *testing.T) {
+	in := roundTripRequest{
+		roundTripPage: &roundTripPage{Page: 2},
+		PagedRequest:  &PagedRequest{Limit: 10},
+		Title:         "Book",
+		Day:           time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC),
+		Ids:           []int{1, 2},
+	}
+	q, err := utils.EncodeQuery(in)
+	assert.Nil(t, err)
+
+	var out roundTripRequest
+	assert.Nil(t, DecodeQuery(httptest.NewRequest("GET", "/conts?"+q.Encode()+"&Hidden=x", nil), &out))
+	assert.Nil(t, out.roundTripPage, "unexported embedded pointers cannot be allocated")
+	out.roundTripPage = in.roundTripPage
+	assert.Equal(t, in, out)
+
+	out = roundTripRequest{}
+	assert.Nil(t, DecodeQuery(httptest.NewRequest("GET", "/conts?title=Book", nil), &out))
+	assert.Nil(t, out.PagedRequest, "embedded pointers are allocated only when needed")
+}
@@ -1,5 +1,11 @@
 package requests
 
+import (
+	"strings"
+
+	"github.com/4books-sparta/utils/filter"
+)
+
 type StringIdRequest struct {
 	Id string `json:"id" validate:"required"`
 }
@@ -9,16 +15,22 @@ type IdRequest struct {
 }
 
 type PagedRequest struct {
-	Limit  uint `json:"limit"`
-	Offset uint `json:"offset"`
+	Limit  uint `json:"limit" query:"limit"`
+	Offset uint `json:"offset" query:"offset"`
+}
+
+// CursorPagedRequest asks for the page after, or before, an opaque cursor
+type CursorPagedRequest struct {
+	Cursor string `json:"cursor" query:"cursor"`
+	Limit  uint   `json:"limit" query:"limit"`
 }
 
 type UserSearchRequest struct {
-	UserId uint32 `json:"user_id"`
+	UserId uint32 `json:"user_id" query:"user_id"`
 }
 
 type LocalizedRequest struct {
-	Locale string `json:"locale" validate:"required"`
+	Locale string `json:"locale" query:"locale" validate:"required"`
 }
 
 type LocalizedPagedUserSearchRequest struct {
@@ -28,19 +40,39 @@ type LocalizedPagedUserSearchRequest struct {
 }
 
 type ContRequest struct {
-	ContType      string   `json:"cont_type"`
-	PublishStates []string `json:"publish_states"`
+	ContType      string   `json:"cont_type" query:"cont_type"`
+	PublishStates []string `json:"publish_states" query:"publish_states"`
 	LocalizedPagedUserSearchRequest
 	IntId    int         `json:"id"`
-	IntIds   []int       `json:"ids,omitempty"`
+	IntIds   []int       `json:"ids,omitempty" query:"ids"`
 	StringId string      `json:"s_id"`
-	Slug     string      `json:"slug" validate:"slug"`
+	Slug     string      `json:"slug" query:"slug" validate:"slug"`
 	Filter   *ContFilter `json:"filter,omitempty"`
 }
 
 type ContFilter struct {
-	B2B  *B2BFilter `json:"b2b,omitempty"`
-	Text string     `json:"text,omitempty"`
+	B2B  *B2BFilter         `json:"b2b,omitempty"`
+	Text string             `json:"text,omitempty"`
+	Expr *filter.Expression `json:"expr,omitempty"`
+}
+
+// Expression merges ContType and PublishStates with the filter expression,
+// comma separated cont types match any of them
+func (r ContRequest) Expression() filter.Expression {
+	e := filter.Expression{}
+	if r.Filter != nil && r.Filter.Expr != nil {
+		e.Where = append(e.Where, r.Filter.Expr.Where...)
+		e.Sort = append(e.Sort, r.Filter.Expr.Sort...)
+	}
+
+	if r.ContType != "" {
+		e.Where = append(e.Where, filter.Condition{Field: "cont_type", Op: filter.OpIn, Values: strings.Split(r.ContType, ",")})
+	}
+	if len(r.PublishStates) > 0 {
+		e.Where = append(e.Where, filter.Condition{Field: "publish_state", Op: filter.OpIn, Values: r.PublishStates})
+	}
+
+	return e
 }
 
 type B2BFilter struct {
@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-kit/kit/endpoint"
+	kitHttp "github.com/go-kit/kit/transport/http"
+)
+
+const (
+	RoleCMS      = "cms"
+	RoleCMSAdmin = "cms-admin"
+)
+
+// DefaultRoleHierarchy maps each role to the roles it includes
+var DefaultRoleHierarchy = map[string][]string{
+	RoleCMSAdmin: {RoleCMS},
+}
+
+// RoleErrorKeys is the Forbidden error key returned when a role is missing
+var RoleErrorKeys = map[string]string{
+	RoleCMS:      ErrorCMSRightsNeeded,
+	RoleCMSAdmin: ErrorCMSAdminRightsNeeded,
+}
+
+type AccessPolicy struct {
+	// Roles accepted by the endpoint, any of them is enough
+	Roles []string
+	// Hierarchy maps a role to the roles it includes, DefaultRoleHierarchy when nil
+	Hierarchy map[string][]string
+	// Permissions maps a role to the permissions it grants
+	Permissions map[string][]string
+	// RequiredPermissions must all be granted to the caller's role
+	RequiredPermissions []string
+	// Owner grants access to callers without the roles when they own the requested resource
+	Owner func(ctx context.Context, auth Authorization, request interface{}) (bool, error)
+	// ErrorKey is the Forbidden error message, by default it is taken from RoleErrorKeys
+	ErrorKey string
+}
+
+func (f *Forwarder) SecureForwardWithRoles(e endpoint.Endpoint, dec kitHttp.DecodeRequestFunc, roles ...string) *kitHttp.Server {
+	return f.SecureForwardWithPolicy(e, dec, &AccessPolicy{Roles: roles})
+}
+
+func (f *Forwarder) SecureForwardWithPolicy(e endpoint.Endpoint, dec kitHttp.DecodeRequestFunc, p *AccessPolicy) *kitHttp.Server {
+	return f.forward(secureWrap(p.Wrap(f.idempotentEndpoint(e)), true), dec, kitHttp.ServerBefore(f.plugAuth))
+}
+
+// AuthorizationFromContext returns the Authorization plugged by SecureForward
+func AuthorizationFromContext(ctx context.Context) (Authorization, bool) {
+	auth, ok := ctx.Value(AuthCtxKey).(Authorization)
+	return auth, ok
+}
+
+// Wrap returns an endpoint middleware enforcing the policy, it expects the authorization in the context
+func (p *AccessPolicy) Wrap(actual endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, req interface{}) (interface{}, error) {
+		auth, ok := AuthorizationFromContext(ctx)
+		if !ok || auth.Error != nil {
+			return nil, AccessError{Err: auth.Error}
+		}
+
+		allowed, err := p.Allows(ctx, auth, req)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, Forbidden{Err: errors.New(p.errorKey())}
+		}
+
+		return actual(ctx, req)
+	}
+}
+
+func (p *AccessPolicy) Allows(ctx context.Context, auth Authorization, req interface{}) (bool, error) {
+	roles := p.expandRole(auth.Role)
+
+	allowed := len(p.Roles) == 0
+	for _, r := range p.Roles {
+		if _, ok := roles[r]; ok {
+			allowed = true
+			break
+		}
+	}
+
+	if allowed && len(p.RequiredPermissions) > 0 {
+		granted := map[string]struct{}{}
+		for r := range roles {
+			for _, perm := range p.Permissions[r] {
+				granted[perm] = struct{}{}
+			}
+		}
+		for _, perm := range p.RequiredPermissions {
+			if _, ok := granted[perm]; !ok {
+				allowed = false
+				break
+			}
+		}
+	}
+
+	if !allowed && p.Owner != nil {
+		return p.Owner(ctx, auth, req)
+	}
+
+	return allowed, nil
+}
+
+// expandRole returns the role together with all the roles it includes
+func (p *AccessPolicy) expandRole(role string) map[string]struct{} {
+	hierarchy := p.Hierarchy
+	if hierarchy == nil {
+		hierarchy = DefaultRoleHierarchy
+	}
+
+	ret := map[string]struct{}{}
+	if role == "" {
+		return ret
+	}
+
+	queue := []string{role}
+	for len(queue) > 0 {
+		r := queue[0]
+		queue = queue[1:]
+		if _, ok := ret[r]; ok {
+			continue
+		}
+		ret[r] = struct{}{}
+		queue = append(queue, hierarchy[r]...)
+	}
+
+	return ret
+}
+
+func (p *AccessPolicy) errorKey() string {
+	if p.ErrorKey != "" {
+		return p.ErrorKey
+	}
+	for _, r := range p.Roles {
+		if k, ok := RoleErrorKeys[r]; ok {
+			return k
+		}
+	}
+
+	return ErrorCMSRightsNeeded
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessPolicy(t *testing.T) {
+	ok := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return true, nil
+	}
+	call := func(p *AccessPolicy, auth Authorization, req interface{}) error {
+		ctx := context.WithValue(context.Background(), AuthCtxKey, auth)
+		_, err := p.Wrap(ok)(ctx, req)
+		return err
+	}
+
+	admin := &AccessPolicy{Roles: []string{RoleCMSAdmin}}
+	assert.Nil(t, call(admin, Authorization{Role: RoleCMSAdmin}, nil))
+	err := call(admin, Authorization{Role: RoleCMS}, nil)
+	assert.IsType(t, Forbidden{}, err)
+	assert.Equal(t, ErrorCMSAdminRightsNeeded, err.Error())
+
+	cms := &AccessPolicy{Roles: []string{RoleCMS}}
+	assert.Nil(t, call(cms, Authorization{Role: RoleCMSAdmin}, nil), "admins inherit cms rights")
+	assert.Equal(t, ErrorCMSRightsNeeded, call(cms, Authorization{User: "1"}, nil).Error())
+
+	perms := &AccessPolicy{
+		Roles:               []string{RoleCMS},
+		Permissions:         map[string][]string{RoleCMS: {"books:read"}, RoleCMSAdmin: {"books:write"}},
+		RequiredPermissions: []string{"books:write"},
+	}
+	assert.NotNil(t, call(perms, Authorization{Role: RoleCMS}, nil))
+	assert.Nil(t, call(perms, Authorization{Role: RoleCMSAdmin}, nil))
+
+	owner := &AccessPolicy{
+		Roles: []string{RoleCMS},
+		Owner: func(ctx context.Context, auth Authorization, req interface{}) (bool, error) {
+			return req.(string) == auth.User, nil
+		},
+	}
+	assert.Nil(t, call(owner, Authorization{User: "7"}, "7"))
+	assert.NotNil(t, call(owner, Authorization{User: "7"}, "8"))
+
+	assert.IsType(t, AccessError{}, call(cms, Authorization{Error: errors.New("expired")}, nil))
+}
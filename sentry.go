@@ -1,7 +1,11 @@
 package utils
 
 import (
+	"context"
+
 	"github.com/getsentry/raven-go"
+
+	"github.com/4books-sparta/utils/logging"
 )
 
 type SentryReporter struct {
@@ -52,3 +56,16 @@ func (r *SentryReporter) Message(message string, ctx ...string) {
 
 	r.client.CaptureMessage(message, tags)
 }
+
+// WithContext returns a reporter tagging every event with the request id of the context
+func (r *SentryReporter) WithContext(ctx context.Context) logging.ErrorReporter {
+	return logging.ReporterWithContext(r, ctx)
+}
+
+func (r *SentryReporter) ReportCtx(ctx context.Context, err error, args ...string) {
+	r.WithContext(ctx).Report(err, args...)
+}
+
+func (r *SentryReporter) MessageCtx(ctx context.Context, message string, args ...string) {
+	r.WithContext(ctx).Message(message, args...)
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"github.com/redis/go-redis/v9"
+
+	"github.com/4books-sparta/utils"
+	"github.com/4books-sparta/utils/health"
+	"github.com/4books-sparta/utils/kafka2"
+)
+
+// The checks live in the health package, these are kept for the services already using them
+
+func DatabaseCheck(db *utils.SqlDatabase) Check {
+	return health.SqlDatabaseCheck(db)
+}
+
+func RedisCheck(c redis.UniversalClient) Check {
+	return health.RedisCheck(c)
+}
+
+func KafkaProducerCheck(p *kafka2.KafkaProducer) Check {
+	return health.KafkaProducerCheck(p)
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/spf13/viper"
+	"goji.io"
+	"goji.io/pat"
+
+	"github.com/4books-sparta/utils"
+	"github.com/4books-sparta/utils/health"
+)
+
+const (
+	DefaultAddr            = ":8080"
+	DefaultLivenessPath    = "/healthz"
+	DefaultReadinessPath   = "/readyz"
+	DefaultMetricsPath     = "/metrics"
+	DefaultDrainPeriod     = 5 * time.Second
+	DefaultShutdownTimeout = 20 * time.Second
+	DefaultCheckTimeout    = health.DefaultTimeout
+)
+
+type Config struct {
+	Addr string
+	// DrainPeriod is how long readiness fails before the listener is closed, so that load balancers stop sending traffic
+	DrainPeriod time.Duration
+	// ShutdownTimeout bounds the wait for the in-flight requests
+	ShutdownTimeout time.Duration
+	// CheckTimeout bounds each check added with AddCheck
+	CheckTimeout  time.Duration
+	LivenessPath  string
+	ReadinessPath string
+	// Health runs the readiness checks, e.g. a registry exporting its metrics. A new one when nil
+	Health *health.HealthRegistry
+	// The metrics are not mounted without MetricsUser
+	MetricsPath     string
+	MetricsUser     string
+	MetricsPassword string
+	MetricsRealm    string
+}
+
+func GetConfig() Config {
+	cfg := Config{
+		Addr:            viper.GetString("http_addr"),
+		DrainPeriod:     viper.GetDuration("http_drain_period"),
+		ShutdownTimeout: viper.GetDuration("http_shutdown_timeout"),
+		MetricsUser:     viper.GetString("prometheus_user"),
+		MetricsPassword: viper.GetString("prometheus_password"),
+		MetricsRealm:    viper.GetString("prometheus_realm"),
+	}
+
+	return cfg.withDefaults()
+}
+
+func (c Config) withDefaults() Config {
+	if c.Addr == "" {
+		c.Addr = DefaultAddr
+	}
+	if c.DrainPeriod == 0 {
+		c.DrainPeriod = DefaultDrainPeriod
+	}
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if c.CheckTimeout == 0 {
+		c.CheckTimeout = DefaultCheckTimeout
+	}
+	if c.LivenessPath == "" {
+		c.LivenessPath = DefaultLivenessPath
+	}
+	if c.ReadinessPath == "" {
+		c.ReadinessPath = DefaultReadinessPath
+	}
+	if c.MetricsPath == "" {
+		c.MetricsPath = DefaultMetricsPath
+	}
+
+	return c
+}
+
+// Check returns an error when the dependency is not usable
+type Check = health.Check
+
+type Server struct {
+	cfg      Config
+	mux      *goji.Mux
+	srv      *http.Server
+	health   *health.HealthRegistry
+	inFlight int64
+	draining atomic.Bool
+}
+
+func New(cfg Config) *Server {
+	cfg = cfg.withDefaults()
+	registry := cfg.Health
+	if registry == nil {
+		registry = health.NewHealthRegistry(nil)
+	}
+
+	s := &Server{
+		cfg:    cfg,
+		mux:    goji.NewMux(),
+		health: registry,
+	}
+	s.mux.Use(s.track)
+	s.mux.HandleFunc(pat.Get(cfg.LivenessPath), s.liveness)
+	s.mux.HandleFunc(pat.Get(cfg.ReadinessPath), s.readiness)
+	if cfg.MetricsUser != "" {
+		s.mux.Handle(pat.Get(cfg.MetricsPath), utils.MakePrometheusHandler(cfg.MetricsUser, cfg.MetricsPassword, cfg.MetricsRealm))
+	}
+
+	s.srv = &http.Server{
+		Addr:    cfg.Addr,
+		Handler: s.mux,
+	}
+
+	return s
+}
+
+// Mux is where the service mounts its routes
+func (s *Server) Mux() *goji.Mux {
+	return s.mux
+}
+
+// AddCheck registers a critical dependency checked by the readiness probe, see Health for the other options
+func (s *Server) AddCheck(name string, c Check) {
+	s.health.Register(name, c, health.Timeout(s.cfg.CheckTimeout))
+}
+
+// Health is the registry of the readiness checks
+func (s *Server) Health() *health.HealthRegistry {
+	return s.health
+}
+
+// Probe runs all the checks concurrently
+func (s *Server) Probe(ctx context.Context) utils.ProbeResponse {
+	return s.health.Probe(ctx)
+}
+
+func (s *Server) InFlight() int64 {
+	return atomic.LoadInt64(&s.inFlight)
+}
+
+func (s *Server) track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.inFlight, 1)
+		defer atomic.AddInt64(&s.inFlight, -1)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Run serves until ctx is done or SIGTERM/SIGINT is received, then shuts down gracefully
+func (s *Server) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Printf("HTTP server listening on %s", s.cfg.Addr)
+		errCh <- s.srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.cfg.DrainPeriod+s.cfg.ShutdownTimeout)
+	defer cancel()
+
+	return s.Shutdown(shutdownCtx)
+}
+
+// Shutdown fails the readiness probe for the drain period, then waits for the in-flight requests
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.draining.Store(true)
+	log.Printf("HTTP server draining for %s", s.cfg.DrainPeriod)
+
+	select {
+	case <-time.After(s.cfg.DrainPeriod):
+	case <-ctx.Done():
+	}
+
+	err := s.srv.Shutdown(ctx)
+	if n := s.InFlight(); n > 0 {
+		log.Printf("HTTP server stopped with %d requests in flight", n)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *Server) liveness(w http.ResponseWriter, _ *http.Request) {
+	health.WriteProbe(w, utils.ProbeResponse{Status: utils.ProbeStatusUp})
+}
+
+func (s *Server) readiness(w http.ResponseWriter, r *http.Request) {
+	res := s.Probe(r.Context())
+	if s.draining.Load() {
+		res.Status = utils.ProbeStatusDown
+	}
+
+	health.WriteProbe(w, res)
+}
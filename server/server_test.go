@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/4books-sparta/utils"
+)
+
+func probe(s *Server, path string) (int, utils.ProbeResponse) {
+	w := httptest.NewRecorder()
+	s.Mux().ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+	res := utils.ProbeResponse{}
+	_ = json.NewDecoder(w.Body).Decode(&res)
+	return w.Code, res
+}
+
+func TestReadinessReportsEachDependency(t *testing.T) {
+	s := New(Config{DrainPeriod: time.Millisecond})
+	s.Health().Register("db", func(context.Context) error {
+		return nil
+	})
+
+	code, res := probe(s, DefaultReadinessPath)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, utils.ProbeStatusUp, res.Checks["db"].Status)
+
+	s.AddCheck("redis", func(context.Context) error {
+		return errors.New("connection refused")
+	})
+	code, res = probe(s, DefaultReadinessPath)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, utils.ProbeStatusUp, res.Checks["db"].Status)
+	assert.Equal(t, "connection refused", res.Checks["redis"].Error)
+
+	code, _ = probe(s, DefaultLivenessPath)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestReadinessFailsWhileDraining(t *testing.T) {
+	s := New(Config{DrainPeriod: time.Millisecond})
+	assert.Nil(t, s.Shutdown(context.Background()))
+
+	code, res := probe(s, DefaultReadinessPath)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, utils.ProbeStatusDown, res.Status)
+}
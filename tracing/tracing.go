@@ -0,0 +1,175 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/4books-sparta/utils/correlation"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	InstrumentationName = "github.com/4books-sparta/utils"
+	AttributeRequestID  = "request.id"
+	AttributeQueryText  = "db.query.text"
+
+	ServerSpanCtxKey = "req-trace-server-span"
+)
+
+var (
+	mu         sync.RWMutex
+	provider   trace.TracerProvider          = noop.NewTracerProvider()
+	propagator propagation.TextMapPropagator = propagation.NewCompositeTextMapPropagator()
+	enabled    bool
+	queryText  bool
+)
+
+// Enable turns on the spans of the library, until it is called every instrumentation is a no-op.
+// When p is nil the W3C trace context and baggage propagators are used
+func Enable(tp trace.TracerProvider, p propagation.TextMapPropagator) {
+	if p == nil {
+		p = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	provider = tp
+	propagator = p
+	enabled = true
+}
+
+func Disable() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	provider = noop.NewTracerProvider()
+	propagator = propagation.NewCompositeTextMapPropagator()
+	enabled = false
+}
+
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return enabled
+}
+
+// CaptureQueryText exports the text of the queries on their spans, off by default:
+// it may carry personal data and it is often large
+func CaptureQueryText(on bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	queryText = on
+}
+
+// QueryText returns the query text attribute, when captured
+func QueryText(sql string) []attribute.KeyValue {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if !queryText {
+		return nil
+	}
+
+	return []attribute.KeyValue{attribute.String(AttributeQueryText, sql)}
+}
+
+func Tracer() trace.Tracer {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return provider.Tracer(InstrumentationName)
+}
+
+func Propagator() propagation.TextMapPropagator {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return propagator
+}
+
+func Start(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+// End records err on the span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// ServerBefore starts the server span of a go-kit HTTP handler, continuing the caller's trace
+func ServerBefore(ctx context.Context, req *http.Request) context.Context {
+	if !Enabled() {
+		return ctx
+	}
+
+	ctx = Propagator().Extract(ctx, propagation.HeaderCarrier(req.Header))
+	ctx, span := Start(ctx, req.Method+" "+req.URL.Path, trace.SpanKindServer,
+		attribute.String("http.request.method", req.Method),
+		attribute.String("url.path", req.URL.Path),
+		attribute.String("user_agent.original", req.UserAgent()),
+		attribute.String(AttributeRequestID, correlation.FromContext(ctx)),
+	)
+
+	return context.WithValue(ctx, ServerSpanCtxKey, span)
+}
+
+// ServerFinalizer ends the span started by ServerBefore with the status of the response, the spans of outer handlers are left alone
+func ServerFinalizer(ctx context.Context, code int, _ *http.Request) {
+	span, ok := ctx.Value(ServerSpanCtxKey).(trace.Span)
+	if !ok || !span.IsRecording() {
+		return
+	}
+
+	span.SetAttributes(attribute.Int("http.response.status_code", code))
+	if code >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, strconv.Itoa(code))
+	}
+	span.End()
+}
+
+// RecordError marks the current span as failed
+func RecordError(ctx context.Context, err error) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() || err == nil {
+		return
+	}
+
+	span.RecordError(err)
+}
+
+// StartClient starts a client span for an outgoing HTTP request and injects its trace context in the headers
+func StartClient(ctx context.Context, req *http.Request) (context.Context, trace.Span) {
+	ctx, span := Start(ctx, req.Method, trace.SpanKindClient,
+		attribute.String("http.request.method", req.Method),
+		attribute.String("url.full", req.URL.Redacted()),
+		attribute.String("server.address", req.URL.Host),
+	)
+	Propagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	return ctx, span
+}
+
+// EndClient ends a span started by StartClient
+func EndClient(span trace.Span, res *http.Response, err error) {
+	if res != nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", res.StatusCode))
+		if res.StatusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, res.Status)
+		}
+	}
+	End(span, err)
+}
@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+const (
+	TxCtxKey = "req-sql-tx"
+
+	PgSerializationFailure = "40001"
+	PgDeadlockDetected     = "40P01"
+
+	DefaultTxMaxAttempts = 3
+)
+
+// DefaultTxBackoff spaces the attempts of a transaction failed for a serialization error or a deadlock
+var DefaultTxBackoff BackoffPolicy = ExponentialBackoff{
+	Initial:    20 * time.Millisecond,
+	Max:        500 * time.Millisecond,
+	Multiplier: 2,
+	Jitter:     0.5,
+}
+
+type txConfig struct {
+	maxAttempts int
+	backoff     BackoffPolicy
+	sqlOpts     *sql.TxOptions
+}
+
+type TxOption func(*txConfig)
+
+// TxMaxAttempts sets how many times the outermost transaction is run, 1 disables the retries
+func TxMaxAttempts(n int) TxOption {
+	return func(c *txConfig) {
+		c.maxAttempts = n
+	}
+}
+
+// TxBackoff spaces the attempts, nil retries at once
+func TxBackoff(b BackoffPolicy) TxOption {
+	return func(c *txConfig) {
+		c.backoff = b
+	}
+}
+
+func TxIsolation(level sql.IsolationLevel) TxOption {
+	return func(c *txConfig) {
+		c.sqlOpts = &sql.TxOptions{Isolation: level}
+	}
+}
+
+func (c *txConfig) wait(ctx context.Context, attempt int) error {
+	if c.backoff == nil {
+		return ctx.Err()
+	}
+
+	return sleepCtx(ctx, c.backoff.Backoff(attempt))
+}
+
+// txState is the transaction carried by the context, one per nesting level
+type txState struct {
+	tx         *SqlDatabase
+	afterHooks []func()
+}
+
+// TxFromContext returns the ambient transaction opened by WithTx
+func TxFromContext(ctx context.Context) (*SqlDatabase, bool) {
+	st, ok := ctx.Value(TxCtxKey).(*txState)
+	if !ok {
+		return nil, false
+	}
+
+	return st.tx, true
+}
+
+// Conn returns the ambient transaction of ctx, or the database bound to ctx.
+// Repositories use it so that they join the transaction of their caller
+func (db *SqlDatabase) Conn(ctx context.Context) *SqlDatabase {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+
+	return &SqlDatabase{db.DB.WithContext(ctx)}
+}
+
+// WithTx runs fn in a transaction, committed when fn returns nil.
+// Inside a transaction, taken from ctx or from db itself, a savepoint is used instead.
+// The outermost transaction is run again on serialization failures and deadlocks,
+// so fn must not have side effects outside of tx: use AfterCommit for them
+func (db *SqlDatabase) WithTx(ctx context.Context, fn func(tx *SqlDatabase) error, opts ...TxOption) error {
+	if parent := db.ambientTx(ctx); parent != nil {
+		return withSavepoint(parent, fn)
+	}
+
+	cfg := txConfig{
+		maxAttempts: DefaultTxMaxAttempts,
+		backoff:     DefaultTxBackoff,
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	for attempt := 1; ; attempt++ {
+		st := &txState{}
+		txOpts := make([]*sql.TxOptions, 0, 1)
+		if cfg.sqlOpts != nil {
+			txOpts = append(txOpts, cfg.sqlOpts)
+		}
+
+		err := db.DB.WithContext(ctx).Transaction(func(gtx *gorm.DB) error {
+			st.tx = &SqlDatabase{gtx.WithContext(context.WithValue(ctx, TxCtxKey, st))}
+			return fn(st.tx)
+		}, txOpts...)
+		if err == nil {
+			for _, h := range st.afterHooks {
+				h()
+			}
+			return nil
+		}
+
+		if attempt >= cfg.maxAttempts || !IsRetryableTxError(err) {
+			return err
+		}
+		if err := cfg.wait(ctx, attempt); err != nil {
+			return err
+		}
+	}
+}
+
+func withSavepoint(parent *txState, fn func(tx *SqlDatabase) error) error {
+	st := &txState{}
+	ctx := parent.tx.Statement.Context
+
+	err := parent.tx.DB.Transaction(func(gtx *gorm.DB) error {
+		st.tx = &SqlDatabase{gtx.WithContext(context.WithValue(ctx, TxCtxKey, st))}
+		return fn(st.tx)
+	})
+	if err != nil {
+		//Rolled back to the savepoint, its hooks are dropped
+		return err
+	}
+
+	parent.afterHooks = append(parent.afterHooks, st.afterHooks...)
+
+	return nil
+}
+
+func (db *SqlDatabase) ambientTx(ctx context.Context) *txState {
+	if st, ok := ctx.Value(TxCtxKey).(*txState); ok {
+		return st
+	}
+	if db.Statement != nil && db.Statement.Context != nil {
+		if st, ok := db.Statement.Context.Value(TxCtxKey).(*txState); ok {
+			return st
+		}
+	}
+
+	return nil
+}
+
+// Context returns the context of the transaction, repositories called with it join the transaction through Conn
+func (db *SqlDatabase) Context() context.Context {
+	if db.Statement != nil && db.Statement.Context != nil {
+		return db.Statement.Context
+	}
+
+	return context.Background()
+}
+
+// AfterCommit runs hook once the outermost transaction has committed, e.g. to publish events.
+// Outside of a transaction the hook runs immediately
+func (db *SqlDatabase) AfterCommit(hook func()) {
+	AfterCommitCtx(db.Context(), hook)
+}
+
+// AfterCommitCtx is AfterCommit for the ambient transaction of ctx
+func AfterCommitCtx(ctx context.Context, hook func()) {
+	if st, ok := ctx.Value(TxCtxKey).(*txState); ok {
+		st.afterHooks = append(st.afterHooks, hook)
+		return
+	}
+
+	hook()
+}
+
+// IsRetryableTxError tells whether the transaction failed for a serialization failure or a deadlock
+func IsRetryableTxError(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	return pgErr.Code == PgSerializationFailure || pgErr.Code == PgDeadlockDetected
+}
@@ -0,0 +1,253 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// recordingDriver logs the statements and fails the commits with the queued errors.
+// The statements affect the queued numbers of rows and the queries return the queued rows, nothing once drained
+type recordingDriver struct {
+	mu         sync.Mutex
+	stmts      []string
+	args       [][]driver.NamedValue
+	commitErrs []error
+	affected   []int64
+	rows       []*recordedRows
+}
+
+func (d *recordingDriver) Open(string) (driver.Conn, error) {
+	return &recordingConn{d: d}, nil
+}
+
+func (d *recordingDriver) log(s string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stmts = append(d.stmts, s)
+}
+
+// logQuery logs the first two words of query and its arguments
+func (d *recordingDriver) logQuery(query string, args []driver.NamedValue) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stmts = append(d.stmts, strings.Join(strings.Fields(query)[:2], " "))
+	d.args = append(d.args, args)
+}
+
+// lastArgs returns the arguments of the last statement
+func (d *recordingDriver) lastArgs() []interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var ret []interface{}
+	for _, a := range d.args[len(d.args)-1] {
+		ret = append(ret, a.Value)
+	}
+	return ret
+}
+
+func (d *recordingDriver) statements() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.stmts...)
+}
+
+type recordingConn struct {
+	d *recordingDriver
+}
+
+func (c *recordingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *recordingConn) Close() error {
+	return nil
+}
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	c.d.log("BEGIN")
+	return c, nil
+}
+
+func (c *recordingConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.d.logQuery(query, args)
+
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	if len(c.d.affected) == 0 {
+		return driver.RowsAffected(0), nil
+	}
+	n := c.d.affected[0]
+	c.d.affected = c.d.affected[1:]
+	return driver.RowsAffected(n), nil
+}
+
+func (c *recordingConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.logQuery(query, args)
+
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	if len(c.d.rows) == 0 {
+		return &recordedRows{}, nil
+	}
+	r := c.d.rows[0]
+	c.d.rows = c.d.rows[1:]
+	return r, nil
+}
+
+type recordedRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *recordedRows) Columns() []string {
+	return r.columns
+}
+
+func (r *recordedRows) Close() error {
+	return nil
+}
+
+func (r *recordedRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func (c *recordingConn) Commit() error {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.stmts = append(c.d.stmts, "COMMIT")
+	if len(c.d.commitErrs) > 0 {
+		err := c.d.commitErrs[0]
+		c.d.commitErrs = c.d.commitErrs[1:]
+		return err
+	}
+	return nil
+}
+
+func (c *recordingConn) Rollback() error {
+	c.d.log("ROLLBACK")
+	return nil
+}
+
+var recordingDrivers sync.Map
+
+// openRecordingDriver returns a pool over a new recordingDriver
+func openRecordingDriver(t *testing.T) (*sql.DB, *recordingDriver) {
+	d := &recordingDriver{}
+	name := fmt.Sprintf("recording-%s-%p", t.Name(), d)
+	if _, loaded := recordingDrivers.LoadOrStore(name, d); !loaded {
+		sql.Register(name, d)
+	}
+	conn, err := sql.Open(name, "")
+	assert.Nil(t, err)
+	conn.SetMaxOpenConns(1)
+
+	return conn, d
+}
+
+func newRecordingDatabase(t *testing.T) (*SqlDatabase, *recordingDriver) {
+	conn, d := openRecordingDriver(t)
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{SkipDefaultTransaction: true})
+	assert.Nil(t, err)
+
+	return &SqlDatabase{db}, d
+}
+
+func TestIsRetryableTxError(t *testing.T) {
+	assert.True(t, IsRetryableTxError(fmt.Errorf("commit: %w", &pgconn.PgError{Code: PgSerializationFailure})))
+	assert.True(t, IsRetryableTxError(&pgconn.PgError{Code: PgDeadlockDetected}))
+	assert.False(t, IsRetryableTxError(&pgconn.PgError{Code: "23505"}))
+	assert.False(t, IsRetryableTxError(errors.New("connection refused")))
+}
+
+func TestNestedTxUsesSavepointsAndDefersHooks(t *testing.T) {
+	db, d := newRecordingDatabase(t)
+	var published []string
+
+	err := db.WithTx(context.Background(), func(tx *SqlDatabase) error {
+		tx.AfterCommit(func() { published = append(published, "outer") })
+
+		//A repository joining the transaction from the context
+		_ = db.WithTx(tx.Context(), func(inner *SqlDatabase) error {
+			AfterCommitCtx(inner.Context(), func() { published = append(published, "dropped") })
+			return errors.New("rolled back")
+		})
+		assert.Nil(t, db.WithTx(tx.Context(), func(inner *SqlDatabase) error {
+			AfterCommitCtx(inner.Context(), func() { published = append(published, "inner") })
+			return nil
+		}))
+
+		assert.Empty(t, published, "hooks wait for the commit")
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"outer", "inner"}, published)
+	assert.Equal(t, []string{
+		"BEGIN",
+		"SAVEPOINT sp0x", "ROLLBACK TO",
+		"SAVEPOINT sp0x",
+		"COMMIT",
+	}, maskSavepoints(d.statements()))
+}
+
+func TestTxRetriesSerializationFailures(t *testing.T) {
+	db, d := newRecordingDatabase(t)
+	d.commitErrs = []error{&pgconn.PgError{Code: PgSerializationFailure}}
+
+	attempts, hooks := 0, 0
+	err := db.WithTx(context.Background(), func(tx *SqlDatabase) error {
+		attempts++
+		tx.AfterCommit(func() { hooks++ })
+		return nil
+	}, TxBackoff(ConstantBackoff{Interval: time.Millisecond}))
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, 1, hooks, "the hooks of the failed attempt are dropped")
+
+	d.commitErrs = []error{&pgconn.PgError{Code: PgDeadlockDetected}}
+	attempts = 0
+	assert.Nil(t, db.WithTx(context.Background(), func(tx *SqlDatabase) error {
+		attempts++
+		return nil
+	}, TxBackoff(nil)))
+	assert.Equal(t, 2, attempts)
+
+	d.commitErrs = []error{&pgconn.PgError{Code: PgDeadlockDetected}}
+	attempts = 0
+	err = db.WithTx(context.Background(), func(tx *SqlDatabase) error {
+		attempts++
+		return nil
+	}, TxMaxAttempts(1))
+	assert.True(t, IsRetryableTxError(err))
+	assert.Equal(t, 1, attempts)
+}
+
+// maskSavepoints hides the generated savepoint names
+func maskSavepoints(stmts []string) []string {
+	for i, s := range stmts {
+		if strings.HasPrefix(s, "SAVEPOINT ") {
+			stmts[i] = "SAVEPOINT sp0x"
+		}
+	}
+	return stmts
+}
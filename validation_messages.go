@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"strings"
+	"sync"
+
+	"gopkg.in/go-playground/validator.v9"
+)
+
+const validationFallbackTag = ""
+
+var (
+	validationMessagesMu sync.RWMutex
+	// validationMessages are keyed by rule, {field} and {param} are replaced
+	validationMessages = map[string]map[Locale]string{
+		validationFallbackTag: {
+			EnLocale: "{field} is not valid",
+			ItLocale: "{field} non è valido",
+			EsLocale: "{field} no es válido",
+		},
+		"required": {
+			EnLocale: "{field} is required",
+			ItLocale: "{field} è obbligatorio",
+			EsLocale: "{field} es obligatorio",
+		},
+		"min": {
+			EnLocale: "{field} must be at least {param}",
+			ItLocale: "{field} deve essere almeno {param}",
+			EsLocale: "{field} debe ser al menos {param}",
+		},
+		"max": {
+			EnLocale: "{field} must be at most {param}",
+			ItLocale: "{field} deve essere al massimo {param}",
+			EsLocale: "{field} debe ser como máximo {param}",
+		},
+		"oneof": {
+			EnLocale: "{field} must be one of {param}",
+			ItLocale: "{field} deve essere uno tra {param}",
+			EsLocale: "{field} debe ser uno de {param}",
+		},
+		"email": {
+			EnLocale: "{field} must be a valid email",
+			ItLocale: "{field} deve essere un indirizzo email valido",
+			EsLocale: "{field} debe ser un correo electrónico válido",
+		},
+		"slug": {
+			EnLocale: "{field} must contain only lowercase letters, digits, - and _",
+			ItLocale: "{field} deve contenere solo lettere minuscole, cifre, - e _",
+			EsLocale: "{field} debe contener solo letras minúsculas, dígitos, - y _",
+		},
+		"locale": {
+			EnLocale: "{field} is not a supported language",
+			ItLocale: "{field} non è una lingua supportata",
+			EsLocale: "{field} no es un idioma soportado",
+		},
+		"cont_type": {
+			EnLocale: "{field} is not a content type",
+			ItLocale: "{field} non è un tipo di contenuto",
+			EsLocale: "{field} no es un tipo de contenido",
+		},
+		"uuid": {
+			EnLocale: "{field} must be a UUID",
+			ItLocale: "{field} deve essere un UUID",
+			EsLocale: "{field} debe ser un UUID",
+		},
+		"e164": {
+			EnLocale: "{field} must be a phone number in international format, e.g. +393331234567",
+			ItLocale: "{field} deve essere un numero di telefono in formato internazionale, es. +393331234567",
+			EsLocale: "{field} debe ser un número de teléfono en formato internacional, p. ej. +34612345678",
+		},
+	}
+)
+
+// RegisterValidationMessages sets the translations of the errors of a rule, {field} and {param} are replaced
+func RegisterValidationMessages(tag string, messages map[Locale]string) {
+	validationMessagesMu.Lock()
+	defer validationMessagesMu.Unlock()
+
+	m, ok := validationMessages[tag]
+	if !ok {
+		m = map[Locale]string{}
+		validationMessages[tag] = m
+	}
+	for l, msg := range messages {
+		m[l] = msg
+	}
+}
+
+// ValidationMessage translates a failed rule, falling back to english and then to a generic message
+func ValidationMessage(l Locale, err validator.FieldError) string {
+	validationMessagesMu.RLock()
+	defer validationMessagesMu.RUnlock()
+
+	msg := ""
+	for _, tag := range []string{err.Tag(), validationFallbackTag} {
+		m := validationMessages[tag]
+		if msg = m[l]; msg != "" {
+			break
+		}
+		if msg = m[EnLocale]; msg != "" {
+			break
+		}
+	}
+
+	return strings.NewReplacer("{field}", err.Field(), "{param}", err.Param()).Replace(msg)
+}
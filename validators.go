@@ -2,18 +2,23 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
+	"reflect"
 	"regexp"
 	"strings"
+	"sync"
 	"unicode"
 
 	"golang.org/x/text/runes"
 	"golang.org/x/text/transform"
 	"golang.org/x/text/unicode/norm"
 	"gopkg.in/go-playground/validator.v9"
+
+	"github.com/4books-sparta/utils/cont"
 )
 
 func String2Slug(input string) string {
@@ -43,24 +48,92 @@ func IsSlug(in string) bool {
 	return valid
 }
 
-func ValidateRequest(request interface{}) error {
-	validate := validator.New()
-	_ = validate.RegisterValidation("slug", isSlug)
+var (
+	validate     *validator.Validate
+	validateOnce sync.Once
+)
+
+// Validator returns the shared validator, with the custom rules of the package registered
+func Validator() *validator.Validate {
+	validateOnce.Do(func() {
+		validate = validator.New()
+		validate.RegisterTagNameFunc(fieldName)
+		_ = validate.RegisterValidation("slug", isSlug)
+		_ = validate.RegisterValidation("locale", isLocale)
+		_ = validate.RegisterValidation("cont_type", isContType)
+	})
+
+	return validate
+}
+
+// fieldName names the fields of the validation errors as the clients send them: the json name, else the query one
+func fieldName(sf reflect.StructField) string {
+	for _, tag := range []string{"json", QueryTagName} {
+		if name := strings.Split(sf.Tag.Get(tag), ",")[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+
+	//The Go name
+	return ""
+}
 
-	err := validate.Struct(request)
+// RegisterValidation adds a custom rule to the shared validator with its messages, see RegisterValidationMessages.
+// Rules must be registered at init, before validating concurrently.
+func RegisterValidation(tag string, fn validator.Func, messages map[Locale]string) error {
+	if err := Validator().RegisterValidation(tag, fn); err != nil {
+		return err
+	}
+	RegisterValidationMessages(tag, messages)
+
+	return nil
+}
+
+func ValidateRequest(request interface{}) error {
+	err := Validator().Struct(request)
 	if err != nil {
+		var children validator.ValidationErrors
+		if !errors.As(err, &children) {
+			return err
+		}
 		return ValidationError{
-			Children: err.(validator.ValidationErrors),
+			Children: children,
 		}
 	}
 
 	return nil
 }
 
+// ValidateRequestCtx validates the request, the messages of the error are in the locale of the context
+func ValidateRequestCtx(ctx context.Context, request interface{}) error {
+	err := ValidateRequest(request)
+
+	var verr ValidationError
+	if l, ok := LocaleFromContext(ctx); ok && errors.As(err, &verr) {
+		verr.Locale = l
+		return verr
+	}
+
+	return err
+}
+
 func isSlug(fl validator.FieldLevel) bool {
 	return IsSlug(fl.Field().String())
 }
 
+func isLocale(fl validator.FieldLevel) bool {
+	return SupportedLocale(Locale(fl.Field().String()))
+}
+
+func isContType(fl validator.FieldLevel) bool {
+	switch fl.Field().String() {
+	case cont.TypeBook, cont.TypeArticle, cont.TypePodcast, cont.TypeTheUpdate, cont.TypeSkill, cont.TypeCategory:
+		return true
+	}
+
+	return false
+}
+
 func DecodeRequestBody(req *http.Request, ret interface{}) error {
 	b, err := DecodeToInterface(req.Body, ret)
 
@@ -81,14 +154,25 @@ type Msg struct {
 	Message string `json:"message"`
 }
 
+// ServiceResponse2Error parses the ErrorEnvelope written by errorEncoder into a typed error
 func ServiceResponse2Error(res *http.Response) error {
-	msg := Msg{}
-	err := DecodeResponseBody(res, &msg)
+	env := ErrorEnvelope{}
+	err := DecodeResponseBody(res, &env)
 	if err != nil {
-		return err
+		//Not an envelope, e.g. an error page from a proxy
+		env.Message = http.StatusText(res.StatusCode)
+		if res.StatusCode == http.StatusNotFound {
+			env.Message = ErrorResourceNotFound
+		}
+	}
+
+	//The status line is authoritative, older services do not write the code in the body
+	env.Code = res.StatusCode
+	if env.Key == "" {
+		env.Key = env.Message
 	}
 
-	return errors.New(msg.Message)
+	return env.ToError()
 }
 
 func DecodeToInterface(r io.Reader, ret interface{}) ([]byte, error) {